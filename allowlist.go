@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Function to run an iptables or ip6tables command, returning its output on failure
+func runFirewallCommand(binary string, args ...string) error {
+	output, err := exec.Command(binary, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", binary, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Function to resolve the allowed domains into their IPv4 and IPv6 addresses
+func resolveAllowedDomains(domains []string) ([]string, []string) {
+	var ipv4, ipv6 []string
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		ips, err := net.LookupIP(domain)
+		if err != nil {
+			logger.Warn("Error resolving allowed domain", "domain", domain, "error", err)
+			continue
+		}
+		for _, ip := range ips {
+			address := ip.String()
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			if ip.To4() != nil {
+				ipv4 = append(ipv4, address)
+			} else {
+				ipv6 = append(ipv6, address)
+			}
+		}
+	}
+	return ipv4, ipv6
+}
+
+// Resolver files DNS queries may go to during allowlist mode. With systemd-resolved /etc/resolv.conf names the local
+// stub, which is reachable over loopback, and the upstream servers it forwards to are listed in the second file
+var resolverFiles = []string{"/etc/resolv.conf", "/run/systemd/resolve/resolv.conf"}
+
+// Function to read the IPv4 and IPv6 addresses of the configured DNS resolvers, leaving out loopback addresses
+func configuredResolvers() ([]string, []string) {
+	var ipv4, ipv6 []string
+	seen := make(map[string]bool)
+	for _, path := range resolverFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != "nameserver" {
+				continue
+			}
+			address, _, _ := strings.Cut(fields[1], "%") // Drop the zone of link-local IPv6 addresses
+			ip := net.ParseIP(address)
+			if ip == nil || ip.IsLoopback() || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			if ip.To4() != nil {
+				ipv4 = append(ipv4, ip.String())
+			} else {
+				ipv6 = append(ipv6, ip.String())
+			}
+		}
+	}
+	return ipv4, ipv6
+}
+
+// Function to (re)build the firewall chain so only loopback, the DNS resolvers and the allowed addresses are reachable.
+// The rules are built in a new chain that replaces the live one, so there is no moment where everything is allowed
+func applyAllowlistFirewall(domains []string) error {
+	// Resolve before the chain is installed, otherwise the lookups themselves could be rejected
+	ipv4, ipv6 := resolveAllowedDomains(domains)
+	if len(ipv4) == 0 && len(ipv6) == 0 {
+		return fmt.Errorf("none of the allowed domains could be resolved")
+	}
+	resolvers4, resolvers6 := configuredResolvers()
+
+	nextChain := allowlistChain + "_NEXT"
+	for _, family := range []struct {
+		binary    string
+		addresses []string
+		resolvers []string
+	}{{"iptables", ipv4, resolvers4}, {"ip6tables", ipv6, resolvers6}} {
+		binary := family.binary
+		// Left over from an interrupted refresh
+		runFirewallCommand(binary, "-F", nextChain)
+		runFirewallCommand(binary, "-X", nextChain)
+		if err := runFirewallCommand(binary, "-N", nextChain); err != nil {
+			return err
+		}
+		rules := [][]string{{"-A", nextChain, "-o", "lo", "-j", "ACCEPT"}}
+		for _, resolver := range family.resolvers {
+			rules = append(rules,
+				[]string{"-A", nextChain, "-d", resolver, "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
+				[]string{"-A", nextChain, "-d", resolver, "-p", "tcp", "--dport", "53", "-j", "ACCEPT"})
+		}
+		for _, address := range family.addresses {
+			rules = append(rules, []string{"-A", nextChain, "-d", address, "-j", "ACCEPT"})
+		}
+		rules = append(rules, []string{"-A", nextChain, "-j", "REJECT"})
+		for _, rule := range rules {
+			if err := runFirewallCommand(binary, rule...); err != nil {
+				return err
+			}
+		}
+
+		// Hook the new chain in ahead of the live one, then retire the live one and take over its name
+		if err := runFirewallCommand(binary, "-I", "OUTPUT", "-j", nextChain); err != nil {
+			return err
+		}
+		for runFirewallCommand(binary, "-C", "OUTPUT", "-j", allowlistChain) == nil {
+			if err := runFirewallCommand(binary, "-D", "OUTPUT", "-j", allowlistChain); err != nil {
+				return err
+			}
+		}
+		runFirewallCommand(binary, "-F", allowlistChain)
+		runFirewallCommand(binary, "-X", allowlistChain)
+		if err := runFirewallCommand(binary, "-E", nextChain, allowlistChain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to remove the allowlist chain from the firewall
+func removeAllowlistFirewall() error {
+	var firstErr error
+	for _, binary := range []string{"iptables", "ip6tables"} {
+		// Unhook every reference to the chains before they can be deleted
+		for _, chain := range []string{allowlistChain, allowlistChain + "_NEXT"} {
+			for runFirewallCommand(binary, "-C", "OUTPUT", "-j", chain) == nil {
+				if err := runFirewallCommand(binary, "-D", "OUTPUT", "-j", chain); err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					break
+				}
+			}
+			runFirewallCommand(binary, "-F", chain)
+			runFirewallCommand(binary, "-X", chain)
+		}
+	}
+	return firstErr
+}
+
+// Function to start allowlist focus mode until the expiry time, optionally locked until then
+func startAllowlistMode(filename string, expiryTime time.Time, locked bool, isInBackground bool) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	if len(allowlist.Domains) == 0 {
+		return fmt.Errorf("no allowed domains configured")
+	}
+	if isAllowlistLockActive(allowlist) {
+		currentExpiry, err := time.Parse(DateTimeLayout, allowlist.Expiry)
+		if err == nil && expiryTime.Before(currentExpiry) {
+			return fmt.Errorf("%w: allowlist mode cannot be shortened", errBlockLocked)
+		}
+		locked = true
+	}
+	if err := applyAllowlistFirewall(allowlist.Domains); err != nil {
+		removeAllowlistFirewall()
+		return fmt.Errorf("error applying firewall rules: %w", err)
+	}
+
+	allowlist.Active = true
+	allowlist.Expiry = formatStoredTime(expiryTime)
+	allowlist.Locked = locked
+	if locked {
+		allowlist.PendingUnblock = ""
+		clearPendingUnblock(allowlistContextKey)
+	}
+	if err := writeAndSave(filename, allowlist); err != nil {
+		return err
+	}
+
+	removeGouroutine(allowlistContextKey)
+	addAllowlistGoroutine(filename, expiryTime, isInBackground)
+	return nil
+}
+
+// Function to stop allowlist focus mode and restore normal network access
+func stopAllowlistMode(filename string) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	if !allowlist.Active {
+		return nil
+	}
+	if isAllowlistLockActive(allowlist) {
+		return fmt.Errorf("%w: allowlist mode (until %s)", errBlockLocked, displayStoredTime(allowlist.Expiry))
+	}
+	removeGouroutine(allowlistContextKey)
+	if err := removeAllowlistFirewall(); err != nil {
+		return fmt.Errorf("error removing firewall rules: %w", err)
+	}
+	allowlist.Active = false
+	allowlist.Locked = false
+	allowlist.PendingUnblock = ""
+	clearPendingUnblock(allowlistContextKey)
+	if err := writeAndSave(filename, allowlist); err != nil {
+		return err
+	}
+	auditLog(auditAllowlistStop, "", nil, nil, "")
+	return nil
+}
+
+// Function to add the goroutine that expires allowlist mode and refreshes resolved addresses
+func addAllowlistGoroutine(filename string, expiryTime time.Time, isInBackground bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	goroutineContexts[allowlistContextKey] = cancel
+	mu.Unlock()
+
+	if isInBackground {
+		wg.Add(1)
+	}
+	go func(expiry time.Time, ctx context.Context) {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		lastRefresh := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Debug("Allowlist goroutine cancelled")
+				if isInBackground {
+					wg.Done()
+				}
+				return
+			case <-ticker.C:
+				if time.Now().After(expiry) || pendingUnblockDue(allowlistContextKey) {
+					reason := unblockCauseCooldown
+					if time.Now().After(expiry) {
+						reason = unblockCauseExpired
+					}
+					clearPendingUnblock(allowlistContextKey)
+					mu.Lock()
+					delete(goroutineContexts, allowlistContextKey)
+					mu.Unlock()
+					if err := removeAllowlistFirewall(); err != nil {
+						logger.Error("Error removing firewall rules", "error", err)
+					}
+					if err := setAllowlistActive(filename, false); err != nil {
+						logger.Error("Error updating allowlist file", "file", filename, "error", err)
+					}
+					logger.Info("Allowlist mode ended", "reason", reason)
+					countUnblock(reason)
+					auditLog(auditAllowlistStop, "", nil, nil, reason)
+					if reason == unblockCauseExpired {
+						notifyBlockEvent(webhookBlockExpire, allowlistContextKey, "", reason)
+					} else {
+						notifyBlockEvent(webhookBlockCancel, allowlistContextKey, "", reason)
+					}
+					if isInBackground {
+						wg.Done()
+					} else {
+						fmt.Println("Allowlist mode ended")
+						showMenu()
+					}
+					return
+				}
+
+				// Addresses behind CDNs change often, so re-resolve the allowed domains periodically
+				if time.Since(lastRefresh) >= allowlistRefreshInterval {
+					lastRefresh = time.Now()
+					allowlist, err := readAllowlistYamlFile(filename)
+					if err != nil {
+						logger.Error("Error reading allowlist file", "file", filename, "error", err)
+						continue
+					}
+					if err := applyAllowlistFirewall(allowlist.Domains); err != nil {
+						logger.Error("Error refreshing firewall rules", "error", err)
+					} else {
+						logger.Debug("Refreshed allowlist firewall rules", "domains", len(allowlist.Domains))
+					}
+				}
+			}
+		}
+	}(expiryTime, ctx)
+}
+
+// Function to resume allowlist mode after a restart if it has not expired yet
+func resumeAllowlistMode(filename string, isInBackground bool) {
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil || !allowlist.Active {
+		return
+	}
+	expiryTime, err := time.Parse(DateTimeLayout, allowlist.Expiry)
+	if err != nil {
+		logger.Error("Error parsing allowlist expiry time", "expiry", allowlist.Expiry, "error", err)
+		return
+	}
+	if time.Now().After(expiryTime) {
+		removeAllowlistFirewall()
+		setAllowlistActive(filename, false)
+		return
+	}
+	logger.Info("Resuming allowlist mode", "expiry", allowlist.Expiry, "locked", allowlist.Locked)
+	restorePendingUnblock(allowlistContextKey, allowlist.PendingUnblock)
+	if err := startAllowlistMode(filename, expiryTime, allowlist.Locked, isInBackground); err != nil {
+		logger.Error("Error resuming allowlist mode", "error", err)
+	}
+}
+
+// Function to print allowlist mode status
+func displayAllowlistStatus(filename string) {
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil || !allowlist.Active {
+		return
+	}
+	fmt.Println("\n***Allowlist mode***")
+	fmt.Printf("Only %s reachable until %s\n", strings.Join(allowlist.Domains, ", "), displayStoredTime(allowlist.Expiry))
+	if allowlist.Locked {
+		fmt.Println("Locked until expiry")
+	}
+	if allowlist.PendingUnblock != "" {
+		fmt.Printf("Pending unblock at: %s\n", displayStoredTime(allowlist.PendingUnblock))
+	}
+}
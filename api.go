@@ -0,0 +1,734 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// apiServer serves the local REST API on top of the same config file functions as the menu
+type apiServer struct {
+	paths          configPaths
+	isInBackground bool // Whether the API is served by the background process, passed on to blockSites
+}
+
+// Handler of an API route. session is the caller's session, empty for routes without authentication.
+// Returns the status code and the response body, or an error with an optional status code
+type apiHandler func(s *apiServer, r *http.Request, session Session) (int, any, error)
+
+// apiRoute describes one endpoint, the OpenAPI spec is generated from the route table
+type apiRoute struct {
+	method    string
+	path      string // net/http pattern, path parameters are written as {name}
+	action    string // Action from roles.go whose role the session token needs, "" for routes without authentication
+	operation string
+	summary   string
+	request   any // Zero value of the request body, nil for routes without a body
+	response  any // Zero value of the response body, nil for routes without a body
+	status    int // Status code on success
+	handler   apiHandler
+}
+
+// Request and response bodies of the API
+type (
+	apiError struct {
+		Error string `json:"error"`
+	}
+	apiStatus struct {
+		Sites           []Site          `json:"sites"`           // Sites blocked right now
+		Allowlist       HeaderAllowlist `json:"allowlist"`       // Allowlist focus mode
+		ActiveSchedules []string        `json:"activeSchedules"` // Schedules and calendars whose window is active right now
+	}
+	apiSiteRequest struct {
+		URL      string `json:"url"`
+		Duration string `json:"duration,omitempty"` // Block the site straight away for this long, e.g. 2h
+		Locked   bool   `json:"locked,omitempty"`   // Lock the block until it expires
+	}
+	apiExtendRequest struct {
+		Duration string `json:"duration"` // Added to the current expiry, e.g. 30m
+	}
+	apiBlockRequest struct {
+		Site     string `json:"site,omitempty"` // Site to block, every site when empty
+		Duration string `json:"duration"`
+		Locked   bool   `json:"locked,omitempty"`
+	}
+	apiUnblockRequest struct {
+		Site string `json:"site,omitempty"`
+		All  bool   `json:"all,omitempty"`
+	}
+	apiUnblockResponse struct {
+		PendingUntil string `json:"pendingUntil,omitempty"` // Time the unblock is carried out when an unblock cooldown is configured
+	}
+)
+
+// Function to get the routes of the API
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{method: "GET", path: "/api/v1/openapi.json", operation: "getOpenAPISpec", summary: "OpenAPI description of this API",
+			status: http.StatusOK, handler: (*apiServer).openAPI},
+		{method: "GET", path: "/api/v1/status", action: actionViewStatus, operation: "getStatus", summary: "Currently blocked sites, allowlist mode and active schedules",
+			response: apiStatus{}, status: http.StatusOK, handler: (*apiServer).getStatus},
+		{method: "GET", path: "/api/v1/sites", action: actionViewStatus, operation: "listSites", summary: "List all sites",
+			response: []Site{}, status: http.StatusOK, handler: (*apiServer).listSites},
+		{method: "POST", path: "/api/v1/sites", action: actionBlock, operation: "addSite", summary: "Add a site, optionally blocking it straight away",
+			request: apiSiteRequest{}, response: Site{}, status: http.StatusCreated, handler: (*apiServer).addSite},
+		{method: "GET", path: "/api/v1/sites/{url}", action: actionViewStatus, operation: "getSite", summary: "Get a site",
+			response: Site{}, status: http.StatusOK, handler: (*apiServer).getSite},
+		{method: "DELETE", path: "/api/v1/sites/{url}", action: actionDeleteSite, operation: "deleteSite", summary: "Unblock and delete a site",
+			status: http.StatusNoContent, handler: (*apiServer).deleteSite},
+		{method: "POST", path: "/api/v1/sites/{url}/extend", action: actionExtend, operation: "extendSite", summary: "Extend the block on a site",
+			request: apiExtendRequest{}, response: Site{}, status: http.StatusOK, handler: (*apiServer).extendSite},
+		{method: "POST", path: "/api/v1/block", action: actionBlock, operation: "block", summary: "Block one or every site for a duration",
+			request: apiBlockRequest{}, response: []Site{}, status: http.StatusOK, handler: (*apiServer).block},
+		{method: "POST", path: "/api/v1/unblock", action: actionUnblock, operation: "unblock", summary: "Unblock one or every site, subject to the unblock cooldown",
+			request: apiUnblockRequest{}, response: apiUnblockResponse{}, status: http.StatusOK, handler: (*apiServer).unblock},
+		{method: "GET", path: "/api/v1/schedules", action: actionViewStatus, operation: "listSchedules", summary: "List all schedules",
+			response: []Schedule{}, status: http.StatusOK, handler: (*apiServer).listSchedules},
+		{method: "POST", path: "/api/v1/schedules", action: actionBlock, operation: "createSchedule", summary: "Create a schedule",
+			request: Schedule{}, response: Schedule{}, status: http.StatusCreated, handler: (*apiServer).createSchedule},
+		{method: "GET", path: "/api/v1/schedules/{name}", action: actionViewStatus, operation: "getSchedule", summary: "Get a schedule",
+			response: Schedule{}, status: http.StatusOK, handler: (*apiServer).getSchedule},
+		{method: "PUT", path: "/api/v1/schedules/{name}", action: actionEditSchedule, operation: "replaceSchedule", summary: "Replace a schedule",
+			request: Schedule{}, response: Schedule{}, status: http.StatusOK, handler: (*apiServer).replaceSchedule},
+		{method: "DELETE", path: "/api/v1/schedules/{name}", action: actionDeleteSchedule, operation: "deleteSchedule", summary: "Delete a schedule",
+			status: http.StatusNoContent, handler: (*apiServer).deleteSchedule},
+	}
+}
+
+// Function to start the REST API if apiAddr is set in settings
+func startAPIServer(paths configPaths, isInBackground bool) {
+	addr := getSettings().APIAddr
+	if addr == "" {
+		return
+	}
+	s := &apiServer{paths: paths, isInBackground: isInBackground}
+	mux := http.NewServeMux()
+	for _, route := range apiRoutes() {
+		mux.HandleFunc(route.method+" "+route.path, s.serve(route))
+	}
+	serveLocal("API", addr, true, mux)
+}
+
+// Function to listen on a TCP address or on a Unix socket given as unix:/path/to.sock.
+// With loopbackOnly, TCP addresses reachable from other machines are refused
+func listenLocal(addr string, loopbackOnly bool) (net.Listener, error) {
+	if path, isSocket := strings.CutPrefix(addr, "unix:"); isSocket {
+		os.Remove(path) // A socket left behind by a previous process refuses new listeners
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+	if loopbackOnly {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("%s is not a loopback address", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Function to serve a handler in a goroutine until the process exits
+func serveLocal(name string, addr string, loopbackOnly bool, handler http.Handler) {
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		// The process handing over to the background process may still hold the address for a moment
+		for attempt := 1; ; attempt++ {
+			listener, err := listenLocal(addr, loopbackOnly)
+			if errors.Is(err, syscall.EADDRINUSE) && attempt < 10 {
+				time.Sleep(time.Second)
+				continue
+			}
+			if err != nil {
+				logger.Error("Error listening", "server", name, "addr", addr, "error", err)
+				return
+			}
+			logger.Info("Serving "+name, "addr", addr)
+			err = server.Serve(listener)
+			logger.Error("Error serving "+name, "addr", addr, "error", err)
+			return
+		}
+	}()
+}
+
+// Function to wrap a route handler with token authentication and JSON encoding
+func (s *apiServer) serve(route apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var session Session
+		if route.action != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found {
+				writeAPIResponse(w, http.StatusUnauthorized, apiError{Error: "bearer token from the login command required"})
+				return
+			}
+			var err error
+			if session, err = validateSessionToken(strings.TrimSpace(token)); err != nil {
+				logger.Warn("API request with an invalid token", "method", r.Method, "path", r.URL.Path)
+				writeAPIResponse(w, http.StatusUnauthorized, apiError{Error: err.Error()})
+				return
+			}
+			if required := actionRoles[route.action]; !roleSatisfies(session.Role, required) {
+				writeAPIResponse(w, http.StatusForbidden, apiError{Error: fmt.Sprintf("session has the %s role, %s required", session.Role, required)})
+				return
+			}
+		}
+
+		status, body, err := route.handler(s, r, session)
+		if err != nil {
+			if status == 0 {
+				status = apiErrorStatus(err)
+			}
+			logger.Warn("API request failed", "method", r.Method, "path", r.URL.Path, "status", status, "error", err)
+			writeAPIResponse(w, status, apiError{Error: err.Error()})
+			return
+		}
+		logger.Debug("API request", "method", r.Method, "path", r.URL.Path, "status", status)
+		writeAPIResponse(w, status, body)
+	}
+}
+
+// Function to pick the status code for an error the handler did not give one for
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBlockLocked):
+		return http.StatusConflict
+	case errors.Is(err, errChallengeRequired):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// Function to write a JSON response, nil bodies are left empty
+func writeAPIResponse(w http.ResponseWriter, status int, body any) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Function to decode a JSON request body, unknown fields are refused so typos do not go unnoticed
+func decodeAPIRequest(r *http.Request, body any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// Function to parse a positive duration from a request
+func parseAPIDuration(duration string) (time.Duration, error) {
+	parsed, err := time.ParseDuration(duration)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", duration)
+	}
+	return parsed, nil
+}
+
+// Function to find a site by its url, returns a 404 error if it is not in the config file
+func (s *apiServer) findSite(url string) (Site, int, error) {
+	normalized, err := NormalizeDomain(url)
+	if err != nil {
+		return Site{}, http.StatusBadRequest, fmt.Errorf("invalid site: %v", err)
+	}
+	headerSites, err := readBlockedYamlFile(s.paths.sitesFile)
+	if err != nil {
+		return Site{}, http.StatusInternalServerError, err
+	}
+	for _, site := range headerSites.Sites {
+		if site.URL == normalized {
+			return site, http.StatusOK, nil
+		}
+	}
+	return Site{}, http.StatusNotFound, fmt.Errorf("site %s not found", normalized)
+}
+
+// Function to find a schedule by its name, returns a 404 error if it is not in the config file
+func (s *apiServer) findSchedule(name string) (Schedule, int, error) {
+	headerSchedule, err := readScheduleYamlFile(s.paths.schedulesFile)
+	if err != nil {
+		return Schedule{}, http.StatusInternalServerError, err
+	}
+	name = FormatString(name)
+	for _, schedule := range headerSchedule.Schedules {
+		if schedule.Name == name {
+			return schedule, http.StatusOK, nil
+		}
+	}
+	return Schedule{}, http.StatusNotFound, fmt.Errorf("schedule %s not found", name)
+}
+
+// Function to check a change to the expiry of sites is allowed. Shortening a block needs the
+// role of the shorten action, and is refused when challenges apply as nobody can answer them
+func (s *apiServer) checkExpiryChange(session Session, urls []string, newExpiryTime time.Time) (int, error) {
+	var reduced []string
+	for _, url := range urls {
+		if isExpiryReduction(s.paths.sitesFile, url, newExpiryTime) {
+			reduced = append(reduced, url)
+		}
+	}
+	if len(reduced) == 0 {
+		return 0, nil
+	}
+	if required := actionRoles[actionShorten]; !roleSatisfies(session.Role, required) {
+		return http.StatusForbidden, fmt.Errorf("shortening the block on %s needs the %s role", strings.Join(reduced, ", "), required)
+	}
+	for _, url := range reduced {
+		if err := refuseChallenges(blockedSiteGroups(s.paths.sitesFile, false, url)); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// Function to block a single site that is already in the config file until a new expiry time
+func (s *apiServer) blockSite(url string, expiryTime time.Time, locked bool) error {
+	if err := updateExpiryTime(s.paths.sitesFile, url, expiryTime, false); err != nil {
+		return err
+	}
+	removeGouroutine(url) // Replace the timer of an active block, the hosts entry stays in place
+	if err := blockSites(false, s.paths.sitesFile, url, expiryTime, s.isInBackground); err != nil {
+		return err
+	}
+	auditLog(actionBlock, url, nil, formatStoredTime(expiryTime), "api")
+	notifyBlockEvent(webhookBlockStart, url, formatLocalTime(expiryTime), "api")
+	if locked {
+		return lockSite(s.paths.sitesFile, url)
+	}
+	return nil
+}
+
+func (s *apiServer) openAPI(r *http.Request, session Session) (int, any, error) {
+	return http.StatusOK, openAPISpec(apiRoutes()), nil
+}
+
+func (s *apiServer) getStatus(r *http.Request, session Session) (int, any, error) {
+	now := time.Now()
+	status := apiStatus{Sites: []Site{}, ActiveSchedules: []string{}}
+	headerSites, err := readBlockedYamlFile(s.paths.sitesFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	for _, site := range headerSites.Sites {
+		if expiryTime, err := time.Parse(DateTimeLayout, site.Duration); err == nil && site.CurrentlyBlocked && now.Before(expiryTime) {
+			status.Sites = append(status.Sites, site)
+		}
+	}
+	status.Allowlist, _ = readAllowlistYamlFile(s.paths.allowlistFile)
+	if headerSchedule, err := readScheduleYamlFile(s.paths.schedulesFile); err == nil {
+		for _, schedule := range headerSchedule.Schedules {
+			if isScheduleWindowActive(schedule, now) {
+				status.ActiveSchedules = append(status.ActiveSchedules, schedule.Name)
+			}
+		}
+		for _, calendar := range headerSchedule.Calendars {
+			if windows, _ := calendarWindows(calendar, now, now.Add(time.Second)); len(windows) > 0 {
+				status.ActiveSchedules = append(status.ActiveSchedules, calendar.Name)
+			}
+		}
+	}
+	return http.StatusOK, status, nil
+}
+
+func (s *apiServer) listSites(r *http.Request, session Session) (int, any, error) {
+	headerSites, err := readBlockedYamlFile(s.paths.sitesFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if headerSites.Sites == nil {
+		headerSites.Sites = []Site{}
+	}
+	return http.StatusOK, headerSites.Sites, nil
+}
+
+func (s *apiServer) addSite(r *http.Request, session Session) (int, any, error) {
+	var request apiSiteRequest
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	url, err := NormalizeDomain(request.URL)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid site: %v", err)
+	}
+	var duration time.Duration
+	if request.Duration != "" {
+		if duration, err = parseAPIDuration(request.Duration); err != nil {
+			return 0, nil, err
+		}
+	}
+	if _, _, err := s.findSite(url); err == nil {
+		return http.StatusConflict, nil, fmt.Errorf("site %s already exists", url)
+	}
+
+	// Sites added without a duration are stored with an expiry of now, the same as sites added to a group
+	expiryTime := time.Now().Add(duration)
+	if err := writeToYamlFile(s.paths.sitesFile, GetNameFromURL(url), url, formatStoredTime(expiryTime)); err != nil {
+		return 0, nil, err
+	}
+	if duration > 0 {
+		if err := s.blockSite(url, expiryTime, request.Locked); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+	}
+	site, status, err := s.findSite(url)
+	if err != nil {
+		return status, nil, err
+	}
+	return http.StatusCreated, site, nil
+}
+
+func (s *apiServer) getSite(r *http.Request, session Session) (int, any, error) {
+	site, status, err := s.findSite(r.PathValue("url"))
+	if err != nil {
+		return status, nil, err
+	}
+	return http.StatusOK, site, nil
+}
+
+func (s *apiServer) deleteSite(r *http.Request, session Session) (int, any, error) {
+	site, status, err := s.findSite(r.PathValue("url"))
+	if err != nil {
+		return status, nil, err
+	}
+	if err := refuseChallenges(blockedSiteGroups(s.paths.sitesFile, false, site.URL)); err != nil {
+		return 0, nil, err
+	}
+	if site.CurrentlyBlocked {
+		pendingUntil, err := unblockBeforeRemoval(s.paths.sitesFile, site.URL)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The site stays until the cooldown has passed and has to be deleted again then
+		if !pendingUntil.IsZero() {
+			return http.StatusConflict, nil, fmt.Errorf("unblock requested, %s can be deleted once it is unblocked at %s", site.URL, formatStoredTime(pendingUntil))
+		}
+	}
+	if err := deleteSiteFromYamlFile(s.paths.sitesFile, "", site.URL); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *apiServer) extendSite(r *http.Request, session Session) (int, any, error) {
+	site, status, err := s.findSite(r.PathValue("url"))
+	if err != nil {
+		return status, nil, err
+	}
+	var request apiExtendRequest
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	duration, err := parseAPIDuration(request.Duration)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Sites that are not blocked are extended from now
+	expiryTime := time.Now()
+	if currentExpiry, err := time.Parse(DateTimeLayout, site.Duration); err == nil && site.CurrentlyBlocked && currentExpiry.After(expiryTime) {
+		expiryTime = currentExpiry
+	}
+	if err := s.blockSite(site.URL, expiryTime.Add(duration), false); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	site, status, err = s.findSite(site.URL)
+	if err != nil {
+		return status, nil, err
+	}
+	return http.StatusOK, site, nil
+}
+
+func (s *apiServer) block(r *http.Request, session Session) (int, any, error) {
+	var request apiBlockRequest
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	duration, err := parseAPIDuration(request.Duration)
+	if err != nil {
+		return 0, nil, err
+	}
+	expiryTime := time.Now().Add(duration)
+
+	var urls, blockURLs []string
+	if request.Site != "" {
+		site, status, err := s.findSite(request.Site)
+		if err != nil {
+			return status, nil, err
+		}
+		urls = []string{site.URL}
+		blockURLs = urls
+	} else {
+		headerSites, err := readBlockedYamlFile(s.paths.sitesFile)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		for _, site := range headerSites.Sites {
+			urls = append(urls, site.URL)
+			// Blocking everything never cuts a running block short, like in the menu it keeps its later expiry time
+			if !isExpiryReduction(s.paths.sitesFile, site.URL, expiryTime) {
+				blockURLs = append(blockURLs, site.URL)
+			}
+		}
+	}
+	if status, err := s.checkExpiryChange(session, blockURLs, expiryTime); err != nil {
+		return status, nil, err
+	}
+
+	var errs []error
+	for _, url := range blockURLs {
+		if err := s.blockSite(url, expiryTime, request.Locked); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return 0, nil, err
+	}
+
+	headerSites, err := readBlockedYamlFile(s.paths.sitesFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	blocked := []Site{}
+	for _, site := range headerSites.Sites {
+		if slices.Contains(urls, site.URL) {
+			blocked = append(blocked, site)
+		}
+	}
+	return http.StatusOK, blocked, nil
+}
+
+func (s *apiServer) unblock(r *http.Request, session Session) (int, any, error) {
+	var request apiUnblockRequest
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if request.All == (request.Site != "") {
+		return 0, nil, fmt.Errorf("give either a site or all")
+	}
+	url := ""
+	if !request.All {
+		site, status, err := s.findSite(request.Site)
+		if err != nil {
+			return status, nil, err
+		}
+		url = site.URL
+	}
+	if err := refuseChallenges(blockedSiteGroups(s.paths.sitesFile, request.All, url)); err != nil {
+		return 0, nil, err
+	}
+	pendingUntil, err := requestUnblock(s.paths.sitesFile, request.All, url)
+	if err != nil {
+		return 0, nil, err
+	}
+	response := apiUnblockResponse{}
+	if !pendingUntil.IsZero() {
+		response.PendingUntil = formatStoredTime(pendingUntil)
+	}
+	return http.StatusOK, response, nil
+}
+
+func (s *apiServer) listSchedules(r *http.Request, session Session) (int, any, error) {
+	headerSchedule, err := readScheduleYamlFile(s.paths.schedulesFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if headerSchedule.Schedules == nil {
+		headerSchedule.Schedules = []Schedule{}
+	}
+	return http.StatusOK, headerSchedule.Schedules, nil
+}
+
+func (s *apiServer) createSchedule(r *http.Request, session Session) (int, any, error) {
+	var request Schedule
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	schedule, err := normalizeSchedule(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, _, err := s.findSchedule(schedule.Name); err == nil {
+		return http.StatusConflict, nil, fmt.Errorf("schedule %s already exists", schedule.Name)
+	}
+	created, err := writeToScheduleYamlFile(s.paths.schedulesFile, schedule)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, created, nil
+}
+
+func (s *apiServer) getSchedule(r *http.Request, session Session) (int, any, error) {
+	schedule, status, err := s.findSchedule(r.PathValue("name"))
+	if err != nil {
+		return status, nil, err
+	}
+	return http.StatusOK, schedule, nil
+}
+
+func (s *apiServer) replaceSchedule(r *http.Request, session Session) (int, any, error) {
+	current, status, err := s.findSchedule(r.PathValue("name"))
+	if err != nil {
+		return status, nil, err
+	}
+	var request Schedule
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if request.Name == "" {
+		request.Name = current.Name
+	}
+	schedule, err := normalizeSchedule(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := replaceScheduleOnYamlFile(s.paths.schedulesFile, current.Name, schedule); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, schedule, nil
+}
+
+func (s *apiServer) deleteSchedule(r *http.Request, session Session) (int, any, error) {
+	schedule, status, err := s.findSchedule(r.PathValue("name"))
+	if err != nil {
+		return status, nil, err
+	}
+	if err := deleteScheduleFromYamlFile(s.paths.schedulesFile, schedule.Name); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// Path parameters in a route pattern, e.g. {url}
+var pathParameterPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// Function to generate the OpenAPI 3 description of the API from its route table
+func openAPISpec(routes []apiRoute) map[string]any {
+	schemas := map[string]any{"Error": jsonSchema(reflect.TypeOf(apiError{}), nil)}
+	paths := map[string]map[string]any{}
+	for _, route := range routes {
+		responses := map[string]any{
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+			},
+		}
+		success := map[string]any{"description": http.StatusText(route.status)}
+		if route.response != nil {
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(route.response), schemas)}}
+		}
+		responses[fmt.Sprint(route.status)] = success
+
+		operation := map[string]any{"operationId": route.operation, "summary": route.summary, "responses": responses}
+		if route.action != "" {
+			operation["description"] = fmt.Sprintf("Needs a session token with the %s role.", actionRoles[route.action])
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+		var parameters []map[string]any
+		for _, match := range pathParameterPattern.FindAllStringSubmatch(route.path, -1) {
+			parameters = append(parameters, map[string]any{"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if route.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(route.request), schemas)}},
+			}
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]any{}
+		}
+		paths[route.path][strings.ToLower(route.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": "selfcontrol", "version": "1"},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "description": "Session token issued by the login command"},
+			},
+		},
+	}
+}
+
+// Function to build the JSON schema of a Go type from its json tags. Named structs are added to
+// schemas and referenced, a nil schemas map inlines them instead
+func jsonSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem(), schemas)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Struct:
+	default:
+		return map[string]any{}
+	}
+
+	name := strings.TrimPrefix(t.Name(), "api")
+	if schemas != nil {
+		if _, exists := schemas[name]; exists {
+			return map[string]any{"$ref": "#/components/schemas/" + name}
+		}
+		schemas[name] = nil // Reserve the name so recursive types terminate
+	}
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		fieldName, options, _ := strings.Cut(tag, ",")
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		properties[fieldName] = jsonSchema(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, fieldName)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	if schemas == nil {
+		return schema
+	}
+	schemas[name] = schema
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
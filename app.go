@@ -3,10 +3,13 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -19,32 +22,85 @@ var (
 	wg                sync.WaitGroup                        // WaitGroup to wait for all goroutines to finish, specifically for background running
 	wgRemove          sync.WaitGroup                        // WaitGroup for main function to wait for goroutines to be removed
 	hostsMu           sync.Mutex                            // Mutex to protect hosts file operations
+	pendingUnblocks   = make(map[string]time.Time)          // Map of url to the time its pending unblock is carried out, protected by mu
 )
 
 // Header of yaml file with all sites
 type HeaderSite struct {
-	Sites []Site `yaml:"sites"`
+	Sites  []Site  `yaml:"sites"`
+	Groups []Group `yaml:"groups,omitempty"`
 }
 
 // Site represents a single site to block
 type Site struct {
-	Name             string `yaml:"name"`
-	URL              string `yaml:"url"`
-	Duration         string `yaml:"duration"`
-	CurrentlyBlocked bool   `yaml:"currentlyBlocked"`
+	Name             string `yaml:"name" json:"name"`
+	URL              string `yaml:"url" json:"url"`
+	Duration         string `yaml:"duration" json:"duration"`
+	CurrentlyBlocked bool   `yaml:"currentlyBlocked" json:"currentlyBlocked"`
+	Group            string `yaml:"group,omitempty" json:"group,omitempty"`
+	Locked           bool   `yaml:"locked,omitempty" json:"locked,omitempty"`                 // Block cannot be removed or shortened before it expires
+	PendingUnblock   string `yaml:"pendingUnblock,omitempty" json:"pendingUnblock,omitempty"` // Time a requested unblock is carried out once the cooldown has passed
+}
+
+// Group represents a named collection of sites, optionally imported from a blocklist file
+type Group struct {
+	Name   string `yaml:"name" json:"name"`
+	Source string `yaml:"source,omitempty" json:"source,omitempty"`
 }
 
 // Header of yaml file with all schedules
 type HeaderSchedule struct {
-	Schedules []Schedule `yaml:"schedules"`
+	Schedules []Schedule       `yaml:"schedules"`
+	Calendars []CalendarSource `yaml:"calendars,omitempty"`
 }
 
 // Schedule represents a single schedule
 type Schedule struct {
-	Name      string   `yaml:"name"`
-	Days      []string `yaml:"days"`
-	StartTime string   `yaml:"startTime"`
-	EndTime   string   `yaml:"endTime"`
+	Name      string   `yaml:"name" json:"name"`
+	Days      []string `yaml:"days" json:"days"`
+	StartTime string   `yaml:"startTime" json:"startTime"`
+	EndTime   string   `yaml:"endTime" json:"endTime"`
+	Mode      string   `yaml:"mode,omitempty" json:"mode,omitempty"`     // block (default) or allowlist
+	Locked    bool     `yaml:"locked,omitempty" json:"locked,omitempty"` // Blocks started by the schedule are locked until the window ends
+	// Days the schedule does not run, e.g. 2026-12-24 or 2026-12-24..2027-01-02
+	Exceptions []string `yaml:"exceptions,omitempty" json:"exceptions,omitempty"`
+	SkipDate   string   `yaml:"skipDate,omitempty" json:"skipDate,omitempty"` // Day skipped once with skip today
+	SkipFrom   string   `yaml:"skipFrom,omitempty" json:"skipFrom,omitempty"` // When the skip takes effect, after the unblock cooldown
+	// Start of each window as a cron expression, e.g. "0 9 * * MON#1" for 09:00 on the first Monday of the month.
+	// Takes precedence over days and times, each window lasts for duration
+	Cron     string `yaml:"cron,omitempty" json:"cron,omitempty"`
+	Duration string `yaml:"duration,omitempty" json:"duration,omitempty"` // Length of a cron window, at most 24h
+	// Days the schedule is in force, e.g. 2026-11-01..2026-12-15. Always when empty
+	Valid []string `yaml:"valid,omitempty" json:"valid,omitempty"`
+	// IANA time zone the days and times are in, e.g. Europe/Berlin. Local time when empty
+	TimeZone string `yaml:"timeZone,omitempty" json:"timeZone,omitempty"`
+}
+
+// HeaderAllowlist holds the domains that stay reachable during allowlist focus mode
+type HeaderAllowlist struct {
+	Domains        []string `yaml:"domains" json:"domains"`
+	Active         bool     `yaml:"active" json:"active"`
+	Expiry         string   `yaml:"expiry" json:"expiry"`
+	Locked         bool     `yaml:"locked,omitempty" json:"locked,omitempty"`
+	PendingUnblock string   `yaml:"pendingUnblock,omitempty" json:"pendingUnblock,omitempty"`
+}
+
+// Settings holds the tunable behaviour of the application
+type Settings struct {
+	UnblockCooldown     string                 `yaml:"unblockCooldown"`               // Waiting period before a requested unblock is carried out, e.g. 15m. 0 unblocks immediately
+	Challenges          []ChallengeConfig      `yaml:"challenges,omitempty"`          // Friction challenges required before unblocking or shortening blocks
+	MaxPasswordAttempts int                    `yaml:"maxPasswordAttempts,omitempty"` // Failed attempts before password entry is locked out, defaults to 5
+	PasswordLockout     string                 `yaml:"passwordLockout,omitempty"`     // How long password entry is locked out for, defaults to 15m
+	PasswordHash        PasswordHashSettings   `yaml:"passwordHash,omitempty"`        // Algorithm and parameters for new password hashes
+	SessionTTL          string                 `yaml:"sessionTTL,omitempty"`          // Lifetime of session tokens issued by the login command, defaults to 15m
+	PasswordPolicy      PasswordPolicySettings `yaml:"passwordPolicy,omitempty"`      // Rules new passwords and admin secrets have to meet
+	LogLevel            string                 `yaml:"logLevel,omitempty"`            // debug, info, warn or error, defaults to info
+	LogMaxSizeMB        int                    `yaml:"logMaxSizeMB,omitempty"`        // Size in MB at which configs/selfcontrol.log is rotated, defaults to 5
+	LogMaxFiles         int                    `yaml:"logMaxFiles,omitempty"`         // Rotated log files kept, defaults to 3
+	MetricsAddr         string                 `yaml:"metricsAddr,omitempty"`         // Loopback address to serve Prometheus metrics on, e.g. 127.0.0.1:9782. Empty disables the endpoint
+	APIAddr             string                 `yaml:"apiAddr,omitempty"`             // Address of the REST API, 127.0.0.1:9783 or unix:/path/to.sock. Empty disables the API
+	Webhooks            []WebhookSettings      `yaml:"webhooks,omitempty"`            // Endpoints block lifecycle events are posted to
+	Notifications       NotificationSettings   `yaml:"notifications,omitempty"`       // Desktop notifications when blocks begin and end, and before schedule windows
 }
 
 // Fcunction to display the status of the blocked sites
@@ -72,11 +128,18 @@ func displayStatus(fileName string) {
 		seconds := int(timeDifference.Seconds()) % 60 // Convert to seconds and get the remainder
 
 		fmt.Printf("- %-20s Time remaining: %d hours %d minutes and %d seconds\n", site.URL, hours, minutes, seconds)
-		fmt.Printf("- %-20s Expiry Time: %s\n", site.URL, site.Duration)
+		fmt.Printf("- %-20s Expiry Time: %s\n", site.URL, displayStoredTime(site.Duration))
+		if site.Locked {
+			fmt.Printf("- %-20s Locked until expiry\n", site.URL)
+		}
+		if site.PendingUnblock != "" {
+			fmt.Printf("- %-20s Pending unblock at: %s\n", site.URL, displayStoredTime(site.PendingUnblock))
+		}
 	}
 	if empty {
 		fmt.Println("No sites are currently blocked")
 	}
+	displayAllowlistStatus(allowlistFilePath)
 }
 
 // Function to show schedules from yaml file
@@ -90,6 +153,16 @@ func showSchedules(filepath string) {
 		fmt.Println("***Schedule ", i+1, " ***")
 		printScheduleInfo(s)
 	}
+	for i, calendar := range schedule.Calendars {
+		fmt.Println("***Calendar ", i+1, " ***")
+		printCalendarInfo(calendar, time.Now())
+	}
+	if holidays := upcomingHolidays(getHolidays(), time.Now()); len(holidays) > 0 {
+		fmt.Println("***Holidays***")
+		for _, holiday := range holidays {
+			fmt.Println(holiday)
+		}
+	}
 }
 
 func showMenu() {
@@ -110,6 +183,22 @@ func showMenu() {
 	fmt.Println("13. Unblock specific site")
 	fmt.Println("14. Exit")
 	fmt.Println("15. Start in background")
+	fmt.Println("16. Import blocklist file")
+	fmt.Println("17. Re-sync imported blocklist")
+	fmt.Println("18. Export configuration bundle")
+	fmt.Println("19. Import configuration bundle")
+	fmt.Println("20. Start allowlist focus mode")
+	fmt.Println("21. Add allowed domain")
+	fmt.Println("22. Remove allowed domain")
+	fmt.Println("23. Lock blocked site until expiry")
+	fmt.Println("24. Cancel pending unblocks")
+	fmt.Println("25. Set up two-factor authentication")
+	fmt.Println("26. Set admin secret (accountability partner)")
+	fmt.Println("27. Show audit log")
+	fmt.Println("28. Verify audit log")
+	fmt.Println("29. Skip schedule today")
+	fmt.Println("30. Preview schedule windows")
+	fmt.Println("31. Show weekly timeline")
 	fmt.Print("\nChoose an option: ")
 }
 
@@ -119,6 +208,22 @@ func readUserInput(reader *bufio.Reader) string {
 	return strings.TrimSpace(input)
 }
 
+// Function to set the expiry time of every site for a block of all sites. Blocks that already run longer keep
+// their expiry, shortening them needs the shorten role and its challenges through "Edit blocked site duration"
+func extendAllExpiries(filename string, headerSites HeaderSite, expiryTime time.Time) {
+	for _, site := range headerSites.Sites {
+		if isExpiryReduction(filename, site.URL, expiryTime) {
+			fmt.Printf("%s stays blocked until %s\n", site.Name, displayStoredTime(site.Duration))
+			continue
+		}
+		if err := updateExpiryTime(filename, site.URL, expiryTime, false); err != nil {
+			fmt.Printf("%s not changed: %v\n", site.Name, err)
+			continue
+		}
+		fmt.Printf("%s blocked until %s\n", site.Name, formatLocalTime(expiryTime))
+	}
+}
+
 // Function to block sites using the specified YAML file and update the /etc/hosts file
 func blockSites(all bool, yamlFile string, specificSite string, expiryTime time.Time, isInBackground bool) error {
 	var sites []string
@@ -126,6 +231,7 @@ func blockSites(all bool, yamlFile string, specificSite string, expiryTime time.
 	// Read sites from the specified YAML file
 	headerSites, err := readBlockedYamlFile(yamlFile)
 	if err != nil {
+		logger.Error("Error reading blocked sites", "file", yamlFile, "error", err)
 		return fmt.Errorf("error reading YAML file: %w", err)
 	}
 
@@ -133,6 +239,11 @@ func blockSites(all bool, yamlFile string, specificSite string, expiryTime time.
 
 		// Prepare hosts file entries
 		for _, site := range headerSites.Sites {
+			if isExpiryReduction(yamlFile, site.URL, expiryTime) {
+				// Blocking everything never cuts a running block short, it keeps its own later expiry time
+				logger.Debug("Keeping later expiry of blocked site", "site", site.URL, "expiry", site.Duration)
+				continue
+			}
 			sites = append(sites, site.URL)
 			editblockedStatusOnYamlFile(yamlFile, site.URL, true)
 			addNewGoroutine(site.URL, expiryTime, isInBackground)
@@ -145,8 +256,12 @@ func blockSites(all bool, yamlFile string, specificSite string, expiryTime time.
 
 	// Update the hosts file with the new entries
 	if err := updateHostsFile(sites); err != nil {
+		metricHostsWriteErrors.Add(1)
+		logger.Error("Error updating hosts file", "sites", sites, "error", err)
 		return fmt.Errorf("error updating hosts file: %w", err)
 	}
+	metricBlocksApplied.Add(int64(len(sites)))
+	logger.Info("Blocked sites", "sites", sites, "expiry", expiryTime.Format(DateTimeLayout), "background", isInBackground)
 
 	return nil
 }
@@ -159,6 +274,8 @@ func cleanup(all bool, url string) error {
 	// Read etc/hosts file
 	content, err := os.ReadFile(hostsFile)
 	if err != nil {
+		metricHostsWriteErrors.Add(1)
+		logger.Error("Error reading hosts file", "error", err)
 		return fmt.Errorf("error reading hosts file: %v", err)
 	}
 
@@ -166,8 +283,28 @@ func cleanup(all bool, url string) error {
 		return fmt.Errorf("empty URL")
 	}
 
+	// Locked blocks cannot be removed until they expire
+	if all {
+		if err := checkSitesUnlocked(absolutePathToSelfControl+"/configs/blocked-sites.yaml", true, ""); err != nil {
+			logger.Warn("Refused to unblock all sites", "error", err)
+			return err
+		}
+		if allowlist, err := readAllowlistYamlFile(absolutePathToSelfControl + "/" + allowlistFilePath); err == nil && isAllowlistLockActive(allowlist) {
+			logger.Warn("Refused to unblock all sites, allowlist mode is locked", "expiry", allowlist.Expiry)
+			return fmt.Errorf("%w: allowlist mode (until %s)", errBlockLocked, displayStoredTime(allowlist.Expiry))
+		}
+	} else if err := checkSitesUnlocked(blockedSitesFilePath, false, url); err != nil {
+		logger.Warn("Refused to unblock site", "site", url, "error", err)
+		return err
+	}
+	target, reason := "all", unblockCauseAll
+	if !all {
+		target, reason = url, unblockReason(blockedSitesFilePath, url)
+	}
+
 	// Read sites from the specified YAML file
 	var sites []string
+	var blocked []string // Sites that were blocked before unblocking all, there is nothing to notify about without them
 	if all {
 		headerSites, err := readBlockedYamlFile(absolutePathToSelfControl + "/configs/blocked-sites.yaml")
 		if err != nil {
@@ -177,9 +314,15 @@ func cleanup(all bool, url string) error {
 		// Prepare hosts file entries
 		for _, site := range headerSites.Sites {
 			sites = append(sites, site.URL)
+			if site.CurrentlyBlocked {
+				blocked = append(blocked, site.URL)
+			}
 			editblockedStatusOnYamlFile(absolutePathToSelfControl+"/configs/blocked-sites.yaml", site.URL, false)
 			removeGouroutine(site.URL)
 		}
+		if err := stopAllowlistMode(absolutePathToSelfControl + "/" + allowlistFilePath); err != nil {
+			logger.Error("Error stopping allowlist mode", "error", err)
+		}
 	} else {
 		sites = append(sites, url)
 		if err := editblockedStatusOnYamlFile(blockedSitesFilePath, url, false); err != nil {
@@ -222,7 +365,20 @@ func cleanup(all bool, url string) error {
 		newLines = newLines[:len(newLines)-1]
 	}
 	// Write back to hosts file
-	return os.WriteFile(hostsFile, []byte(strings.Join(newLines, "\n")), 0644)
+	if err := os.WriteFile(hostsFile, []byte(strings.Join(newLines, "\n")), 0644); err != nil {
+		metricHostsWriteErrors.Add(1)
+		logger.Error("Error writing hosts file", "error", err)
+		return err
+	}
+	countUnblock(reason)
+	logger.Info("Unblocked", "target", target, "reason", reason)
+	auditLog(actionUnblock, target, nil, nil, reason)
+	if reason == unblockCauseExpired {
+		notifyBlockEvent(webhookBlockExpire, target, "", reason)
+	} else if !all || len(blocked) > 0 {
+		notifyBlockEvent(webhookBlockCancel, target, "", reason)
+	}
+	return nil
 }
 
 // Function to block sites based on schedule in yaml file
@@ -230,35 +386,90 @@ func loadSchedule(data HeaderSchedule, name string, currentTime time.Time) {
 	for _, schedule := range data.Schedules {
 		if schedule.Name == name {
 			fmt.Printf("Found schedule %s\n", name)
-			for _, day := range schedule.Days {
-				if strings.ToLower(currentTime.Weekday().String()) == day && currentTime.Format("15:04") >= schedule.StartTime && currentTime.Format("15:04") <= schedule.EndTime {
-					fmt.Printf("Block is in effect until %s!\n", schedule.EndTime)
-					endTime, err := time.Parse("15:04", schedule.EndTime)
-					if err != nil {
-						fmt.Printf("Error parsing end time: %v\n", err)
-						break
+			windows := scheduleWindows(schedule, currentTime, currentTime.Add(time.Second))
+			if len(windows) > 0 {
+				// Overlapping cron windows block until the last of them ends
+				finalEndTime := windows[0].End
+				for _, window := range windows {
+					if window.End.After(finalEndTime) {
+						finalEndTime = window.End
 					}
-					finalEndTime := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), endTime.Hour(), endTime.Minute(), endTime.Second(), 0, currentTime.Location())
-					blockSites(true, blockedSitesFilePath, "", finalEndTime, false)
-					var headerSite HeaderSite
-					headerSite, err = readBlockedYamlFile(blockedSitesFilePath)
-					if err != nil {
-						fmt.Printf("Error reading blocked sites: %v\n", err)
-					}
-					for _, site := range headerSite.Sites {
-						updateExpiryTime(blockedSitesFilePath, site.URL, finalEndTime, false)
-						editblockedStatusOnYamlFile(blockedSitesFilePath, site.URL, true)
-					}
-					displayStatus(blockedSitesFilePath)
-					return
 				}
+				fmt.Printf("Block is in effect until %s!\n", formatLocalTime(finalEndTime))
+				applyScheduleWindow(name, schedule.Mode, schedule.Locked, finalEndTime)
+				return
+			}
+			if reason := scheduleSkipReason(schedule, getHolidays(), currentTime); reason != "" {
+				logger.Info("Schedule not running today", "schedule", name, "reason", reason)
+				fmt.Printf("Not blocking sites, the schedule is not running today: %s\n", reason)
+				return
 			}
+			logger.Debug("Schedule loaded outside its window", "schedule", name)
 			fmt.Println("Not time to block sites")
+			return
+		}
+	}
+	for _, calendar := range data.Calendars {
+		if FormatString(calendar.Name) == name {
+			fmt.Printf("Found calendar %s\n", name)
+			windows, err := calendarWindows(calendar, currentTime, currentTime.Add(time.Second))
+			if err != nil {
+				logger.Error("Error reading calendar", "calendar", name, "file", calendar.File, "error", err)
+				fmt.Printf("Error reading calendar: %v\n", err)
+				return
+			}
+			if len(windows) == 0 {
+				logger.Debug("Calendar loaded outside its events", "calendar", name)
+				fmt.Println("Not time to block sites")
+				return
+			}
+			// Overlapping events block until the last of them ends
+			finalEndTime := windows[0].End
+			for _, window := range windows {
+				if window.End.After(finalEndTime) {
+					finalEndTime = window.End
+				}
+			}
+			fmt.Printf("Block for %s is in effect until %s!\n", windows[0].Title, formatLocalTime(finalEndTime))
+			applyScheduleWindow(name, windows[0].Mode, calendar.Locked, finalEndTime)
+			return
 		}
 	}
 	fmt.Printf("Schedule %s not found\n", name)
 }
 
+// Function to start the block or allowlist mode of a schedule window until it ends
+func applyScheduleWindow(name string, mode string, locked bool, finalEndTime time.Time) {
+	if mode == scheduleModeAllowlist {
+		if err := startAllowlistMode(allowlistFilePath, finalEndTime, locked, false); err != nil {
+			logger.Error("Error starting allowlist mode for schedule", "schedule", name, "error", err)
+			fmt.Printf("Error starting allowlist mode: %v\n", err)
+		} else {
+			logger.Info("Schedule started allowlist mode", "schedule", name, "expiry", finalEndTime.Format(DateTimeLayout), "locked", locked)
+			auditLog(auditAllowlistStart, "", nil, formatStoredTime(finalEndTime), "schedule "+name)
+		}
+		displayAllowlistStatus(allowlistFilePath)
+		return
+	}
+	blockSites(true, blockedSitesFilePath, "", finalEndTime, false)
+	logger.Info("Schedule blocked sites", "schedule", name, "expiry", finalEndTime.Format(DateTimeLayout), "locked", locked)
+	auditLog(actionBlock, "all", nil, formatStoredTime(finalEndTime), "schedule "+name)
+	notifyBlockEvent(webhookBlockStart, "all", formatLocalTime(finalEndTime), "schedule "+name)
+	headerSite, err := readBlockedYamlFile(blockedSitesFilePath)
+	if err != nil {
+		logger.Error("Error reading blocked sites", "file", blockedSitesFilePath, "error", err)
+		fmt.Printf("Error reading blocked sites: %v\n", err)
+	}
+	extendAllExpiries(blockedSitesFilePath, headerSite, finalEndTime)
+	for _, site := range headerSite.Sites {
+		editblockedStatusOnYamlFile(blockedSitesFilePath, site.URL, true)
+		if locked {
+			lockSite(blockedSitesFilePath, site.URL)
+		}
+	}
+	displayStatus(blockedSitesFilePath)
+}
+
 // Function to add new goroutine when editing or adding to yaml file
 func addNewGoroutine(url string, expiryTime time.Time, isInBackground bool) {
 	ctx, cancel := context.WithCancel(context.Background()) // Create a new context for each site
@@ -272,26 +483,41 @@ func addNewGoroutine(url string, expiryTime time.Time, isInBackground bool) {
 	go func(expiry time.Time, url string, ctx context.Context) {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
+		tamperTicker := time.NewTicker(tamperCheckInterval)
+		defer tamperTicker.Stop()
 
 		for {
 			select {
 			case <-ctx.Done(): // Check if context is cancelled through the cancel() function in cleanup
-				fmt.Printf("Goroutine for %s cancelled.\n", url)
-				showMenu()
+				logger.Debug("Site goroutine cancelled", "site", url)
 				if isInBackground {
 					wg.Done()
+				} else {
+					showMenu()
 				}
 				return
-			case <-ticker.C: // Counter to automatically remove site after expiry time
-				if time.Now().After(expiry) {
-					cleanup(false, url) // Replace with actual cleanup logic
-					fmt.Printf("Unblocked %s\n", url)
-					showMenu()
+			case <-ticker.C: // Counter to automatically remove site after expiry time or once a pending unblock is due
+				if time.Now().After(expiry) || pendingUnblockDue(url) {
+					if err := cleanup(false, url); err != nil {
+						logger.Error("Error unblocking site", "site", url, "error", err)
+					}
+					clearPendingUnblock(url) // cleanup sends the notification that the block ended
 					if isInBackground {
 						wg.Done()
 					}
 					return
 				}
+			case <-tamperTicker.C: // Put back the hosts entry if it was removed by hand
+				restored, err := restoreHostsEntry(ctx, url)
+				if err != nil {
+					metricHostsWriteErrors.Add(1)
+					logger.Error("Error checking hosts entry", "site", url, "error", err)
+				} else if restored {
+					metricTamperReapplied.Add(1)
+					logger.Warn("Hosts entry was removed outside selfcontrol, restored it", "site", url)
+					auditLog(auditTamper, url, nil, nil, "hosts entry removed outside selfcontrol, restored")
+					notifyBlockEvent(webhookTamper, url, "", "hosts entry removed outside selfcontrol, restored")
+				}
 			}
 		}
 	}(expiryTime, url, ctx)
@@ -304,7 +530,7 @@ func removeGouroutine(url string) {
 	if cancel, exists := goroutineContexts[url]; exists { //accessing the goroutine map to find the correct cancel() function for the url
 		cancel() // Cancelling the goroutine using the cancel function found in the map
 		delete(goroutineContexts, url)
-		fmt.Printf("\nCancelled goroutine for site: %s\n", url)
+		logger.Debug("Cancelled goroutine", "site", url)
 	}
 	wgRemove.Done()
 	mu.Unlock()
@@ -313,54 +539,55 @@ func removeGouroutine(url string) {
 
 // Function to block sites when being run in the background and during startup
 func backgroundBlocker(startup bool) {
-	fmt.Println("\n**********Background blocking**********")
-	currentTime := time.Now()
-	parsedTime, err := time.Parse(DateTimeLayout, currentTime.Format(DateTimeLayout))
-	if err != nil {
-		fmt.Printf("Error parsing time: %v\n", err)
-		return
-	}
-	fmt.Println("Time started: ", parsedTime)
-	var path string
+	logger.Info("Background blocking started", "pid", os.Getpid(), "startup", startup)
+	var path, allowlistPath string
 	if startup {
 		path = absolutePathToSelfControl + "/configs/blocked-sites.yaml"
+		allowlistPath = absolutePathToSelfControl + "/" + allowlistFilePath
 		// Write the PID to selfcontrol.lock in tmp
 		pid := os.Getpid()
 		lockFilePath := absolutePathToSelfControl + "/tmp/selfcontrol.lock"
 		if err := os.WriteFile(lockFilePath, []byte(fmt.Sprintf("%d", pid)), 0644); err != nil {
-			fmt.Printf("Error writing PID to lock file: %v\n", err)
+			logger.Error("Error writing PID to lock file", "file", lockFilePath, "error", err)
 			return
 		}
 	} else {
 		path = blockedSitesFilePath
+		allowlistPath = allowlistFilePath
 	}
+	paths := configPaths{sitesFile: path, schedulesFile: filepath.Join(filepath.Dir(path), filepath.Base(schedulesFilePath)), allowlistFile: allowlistPath}
+	startMetricsServer(paths)
+	startAPIServer(paths, true)
+	startWebhookSpooler()
+	startScheduleNotifier(paths.schedulesFile)
 	sites, err := readBlockedYamlFile(path)
 	if err != nil {
-		fmt.Printf("Error reading YAML file: %v\n", err)
+		logger.Error("Error reading blocked sites", "file", path, "error", err)
 		return
 	}
 	// Go through all sites and block them if they are currently blocked and the duration has not expired
 	for _, site := range sites.Sites {
 		parsedTime, err := time.Parse(DateTimeLayout, site.Duration)
 		if err != nil {
-			fmt.Printf("Error parsing duration for site %s: %v\n", site.URL, err)
+			logger.Error("Error parsing expiry time", "site", site.URL, "expiry", site.Duration, "error", err)
 			continue
 		}
 		if site.CurrentlyBlocked && time.Now().Before(parsedTime) {
-			fmt.Printf("Blocking %s until %s\n", site.Name, site.Duration)
-			durationTime, err := time.Parse(DateTimeLayout, site.Duration)
-			if err != nil {
-				fmt.Printf("Error parsing duration for site %s: %v\n", site.URL, err)
-				continue
-			}
-			blockSites(false, path, site.URL, durationTime, true)
+			logger.Info("Resuming block", "site", site.URL, "expiry", site.Duration, "locked", site.Locked, "pendingUnblock", site.PendingUnblock)
+			restorePendingUnblock(site.URL, site.PendingUnblock)
+			blockSites(false, path, site.URL, parsedTime, true)
 		}
 	}
-	fmt.Println(goroutineContexts)
+	resumeAllowlistMode(allowlistPath, true)
+	mu.Lock()
+	logger.Info("Waiting for blocks to expire", "goroutines", len(goroutineContexts))
+	mu.Unlock()
 	wg.Wait()
 	// Once all goroutines are done, cleanup all sites
-	cleanup(true, "")
-	fmt.Println("Background blocking completed")
+	if err := cleanup(true, ""); err != nil {
+		logger.Error("Error during final cleanup", "error", err)
+	}
+	logger.Info("Background blocking completed")
 }
 
 // Function to check and remove any existing background runtime of application by checking pid on lockfile
@@ -423,13 +650,25 @@ func checkAndCleanupExistingInstance() error {
 func main() {
 	// Check if running in background
 	if os.Getenv("SELFCONTROL_BACKGROUND") == "1" {
+		setupLogging(logTargetFile)
 		backgroundBlocker(false)
 		return
 	}
 	if os.Getenv("SELFCONTROL_STARTUP") == "1" {
+		setupLogging(logTargetJournal)
 		backgroundBlocker(true)
 		return
 	}
+	setupLogging(logTargetFile)
+
+	// Run a single command non-interactively if one is given
+	options, args, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) > 0 {
+		os.Exit(runCommand(options, args))
+	}
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -439,31 +678,55 @@ func main() {
 	go func() {
 		sig := <-sigChan
 		fmt.Printf("\nReceived signal: %v\n", sig)
-		// Clean up all blocked sites
-		if err := cleanup(true, ""); err != nil {
-			fmt.Printf("Error during cleanup: %v\n", err)
-		}
+		exitKeepingBlocks()
+		flushNotices()
 		os.Exit(0)
 	}()
 
 	reader := bufio.NewReader(os.Stdin)
 
+	// A missing password file during a block means it was deleted, not that this is a fresh install
+	if _, err := os.Stat(getPasswordFilePath()); err != nil && blockingSessionActive() {
+		fmt.Println("Password file is missing while sites are blocked, refusing to create a new password until the block ends")
+		os.Exit(1)
+	}
+
 	// Verify password before allowing access
 	for {
+		if options.passwordStdin {
+			password, err := readPasswordFrom(reader)
+			if err == nil {
+				err = loginWithPassword(password)
+			}
+			if err != nil {
+				fmt.Printf("Access denied: %v\n", err)
+				os.Exit(1)
+			}
+			break
+		}
 		if !verifyPassword(reader) {
 			fmt.Println("Access denied")
+			// Prompting again would only be refused until the lockout ends
+			if authLockedOut() != nil {
+				os.Exit(1)
+			}
 		} else {
 			break
 		}
 	}
 
 	// Remove blocked sites that have expired
-	err := removedExpiredBlocks()
+	err = removedExpiredBlocks()
 	if err != nil {
 		fmt.Printf("Error removing expired blocks: %v\n", err)
 	}
 
 	addBackgroundBlocks()
+	paths := configPaths{sitesFile: blockedSitesFilePath, schedulesFile: schedulesFilePath, allowlistFile: allowlistFilePath}
+	startMetricsServer(paths)
+	startAPIServer(paths, false)
+	startWebhookSpooler()
+	startScheduleNotifier(paths.schedulesFile)
 
 	for {
 		wgRemove.Wait()
@@ -475,6 +738,7 @@ func main() {
 
 			sitesFileLocation := blockedSitesFilePath
 			duration := getDuration(reader)
+			locked := queryForLock(reader)
 
 			// Calculate expiry time
 			expiryTime := time.Now().Add(duration)
@@ -484,16 +748,20 @@ func main() {
 				fmt.Printf("Error reading YAML file: %v\n", err)
 				continue
 			}
-			for _, site := range headerSites.Sites {
-				updateExpiryTime(sitesFileLocation, site.URL, expiryTime, false)
-				fmt.Printf("%s blocked until %s\n", site.Name, expiryTime.Format(DateTimeLayout))
-			}
+			extendAllExpiries(sitesFileLocation, headerSites, expiryTime)
 
 			// Block sites
 			if err := blockSites(true, sitesFileLocation, "", expiryTime, false); err != nil {
 				fmt.Printf("Error blocking sites: %v\n", err)
 				continue
 			}
+			auditLog(actionBlock, "all", nil, formatStoredTime(expiryTime), "")
+			notifyBlockEvent(webhookBlockStart, "all", formatLocalTime(expiryTime), "")
+			if locked {
+				for _, site := range headerSites.Sites {
+					lockSite(sitesFileLocation, site.URL)
+				}
+			}
 
 		case "2": // Show current blocked sites
 			fmt.Println("Chosen to show current status")
@@ -501,7 +769,11 @@ func main() {
 
 		case "3": // Add new site to block
 			fmt.Print("Enter site URL: ")
-			site := FormatString(readUserInput(reader))
+			site, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid site: %v\n", err)
+				continue
+			}
 			fmt.Print("Enter blocking duration: ")
 			duration := readUserInput(reader)
 			parsedDuration, err := time.ParseDuration(duration)
@@ -510,25 +782,67 @@ func main() {
 				continue
 			}
 			expiryTime := time.Now().Add(parsedDuration)
+			locked := queryForLock(reader)
 			name := GetNameFromURL(site)
-			formattedExpiryTime := expiryTime.Format(DateTimeLayout)
+			formattedExpiryTime := formatLocalTime(expiryTime)
 			fmt.Print("Expiry Time: ", formattedExpiryTime)
-			writeToYamlFile(blockedSitesFilePath, name, site, formattedExpiryTime)
+			writeToYamlFile(blockedSitesFilePath, name, site, formatStoredTime(expiryTime))
 			blockSites(false, blockedSitesFilePath, site, expiryTime, false)
+			auditLog(actionBlock, site, nil, formatStoredTime(expiryTime), "")
+			notifyBlockEvent(webhookBlockStart, site, formattedExpiryTime, "")
+			if locked {
+				if err := lockSite(blockedSitesFilePath, site); err != nil {
+					fmt.Printf("Error locking site: %v\n", err)
+				}
+			}
 
 		case "4": // Edit blocked site duration
 			fmt.Print("Enter which site to change expiry time: ")
-			site := FormatString(readUserInput(reader))
+			site, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid site: %v\n", err)
+				continue
+			}
 			fmt.Print("Enter new expiry time: ")
 			newExpiryTime := time.Now().Add(getDuration(reader))
+			if isExpiryReduction(blockedSitesFilePath, site, newExpiryTime) {
+				if !authorize(reader, actionShorten) {
+					fmt.Println("Access denied")
+					continue
+				}
+				if err := runChallenges(reader, blockedSiteGroups(blockedSitesFilePath, false, site), "shorten the block on", site); err != nil {
+					fmt.Printf("Error updating expiry time: %v\n", err)
+					continue
+				}
+			}
 			if err := updateExpiryTime(blockedSitesFilePath, site, newExpiryTime, true); err != nil {
 				fmt.Printf("Error updating expiry time: %v\n", err)
 			}
 
 		case "5": // Delete site from yaml configuration
 			fmt.Print("Enter site to delete from Config: ")
-			site := FormatString(readUserInput(reader))
-			cleanup(false, site)
+			site, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid site: %v\n", err)
+				continue
+			}
+			if !authorize(reader, actionDeleteSite) {
+				fmt.Println("Access denied")
+				continue
+			}
+			if err := runChallenges(reader, blockedSiteGroups(blockedSitesFilePath, false, site), "delete", site); err != nil {
+				fmt.Printf("Error deleting site: %v\n", err)
+				continue
+			}
+			pendingUntil, err := unblockBeforeRemoval(blockedSitesFilePath, site)
+			if err != nil {
+				fmt.Printf("Error deleting site: %v\n", err)
+				continue
+			}
+			if !pendingUntil.IsZero() {
+				fmt.Printf("Unblock requested, %s can be deleted once it is unblocked at %s\n", site, formatLocalTime(pendingUntil))
+				continue
+			}
 			if err := deleteSiteFromYamlFile(blockedSitesFilePath, "", site); err != nil {
 				fmt.Printf("Error deleting site: %v\n", err)
 			}
@@ -551,11 +865,19 @@ func main() {
 		case "9": // Delete schedule
 			fmt.Print("Enter name of schedule to delete: ")
 			name := FormatString(readUserInput(reader))
+			if !authorize(reader, actionDeleteSchedule) {
+				fmt.Println("Access denied")
+				continue
+			}
 			if err := deleteScheduleFromYamlFile(schedulesFilePath, name); err != nil {
 				fmt.Printf("Error deleting schedule: %v\n", err)
 			}
 
 		case "10": // Edit schedule
+			if !authorize(reader, actionEditSchedule) {
+				fmt.Println("Access denied")
+				continue
+			}
 			if err := editSchedulesonYamlFile(schedulesFilePath, reader); err != nil {
 				fmt.Printf("Error editing schedule: %v\n", err)
 				continue
@@ -568,19 +890,52 @@ func main() {
 				fmt.Println("Password changed successfully")
 			}
 		case "12": // Unblock all sites
+			if !authorize(reader, actionUnblock) {
+				fmt.Println("Access denied")
+				continue
+			}
+			if err := runChallenges(reader, blockedSiteGroups(blockedSitesFilePath, true, ""), "unblock", "all sites"); err != nil {
+				fmt.Printf("Error unblocking sites: %v\n", err)
+				continue
+			}
+			pendingUntil, err := requestUnblock(blockedSitesFilePath, true, "")
+			if err != nil {
+				fmt.Printf("Error unblocking sites: %v\n", err)
+				continue
+			}
+			if !pendingUntil.IsZero() {
+				fmt.Printf("Unblock requested, all sites will be unblocked at %s unless cancelled\n", formatLocalTime(pendingUntil))
+				continue
+			}
 			fmt.Println("Unblocked all sites")
-			cleanup(true, "")
 		case "13": // Unblock specific site
 			fmt.Print("Enter site to unblock: ")
-			site := FormatString(readUserInput(reader))
-			if err := cleanup(false, site); err != nil {
+			site, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid site: %v\n", err)
+				continue
+			}
+			if !authorize(reader, actionUnblock) {
+				fmt.Println("Access denied")
+				continue
+			}
+			if err := runChallenges(reader, blockedSiteGroups(blockedSitesFilePath, false, site), "unblock", site); err != nil {
+				fmt.Printf("Error unblocking site: %v\n", err)
+				continue
+			}
+			pendingUntil, err := requestUnblock(blockedSitesFilePath, false, site)
+			if err != nil {
 				fmt.Printf("Error unblocking site: %v\n", err)
 				continue
 			}
+			if !pendingUntil.IsZero() {
+				fmt.Printf("Unblock requested, %s will be unblocked at %s unless cancelled\n", site, formatLocalTime(pendingUntil))
+				continue
+			}
 			fmt.Println("Unblocked site: ", site)
 		case "14": // Exit Gracefully
+			exitKeepingBlocks()
 			fmt.Println("Goodbye!")
-			cleanup(true, "")
 			wgRemove.Wait()
 			return
 		case "15": // Start process in background
@@ -588,21 +943,219 @@ func main() {
 				startBackground()
 			}
 			return
+		case "16": // Import blocklist file into a group
+			fmt.Print("Enter path to blocklist file: ")
+			path := readUserInput(reader)
+			fmt.Print("Enter group name: ")
+			group := readUserInput(reader)
+			added, skipped, err := importBlocklist(blockedSitesFilePath, path, group)
+			if err != nil {
+				fmt.Printf("Error importing blocklist: %v\n", err)
+				continue
+			}
+			fmt.Printf("Imported %d sites into group %s (%d already configured)\n", added, FormatString(group), skipped)
+		case "17": // Re-sync group from its blocklist file
+			if !authorize(reader, actionResyncGroup) {
+				fmt.Println("Access denied")
+				continue
+			}
+			fmt.Print("Enter group name to re-sync: ")
+			group := readUserInput(reader)
+			added, removed, skipped, err := resyncBlocklistGroup(blockedSitesFilePath, group)
+			if err != nil {
+				fmt.Printf("Error re-syncing blocklist: %v\n", err)
+				continue
+			}
+			fmt.Printf("Re-synced group %s: %d added, %d removed, %d skipped\n", FormatString(group), added, removed, skipped)
+		case "18": // Export sites, groups and schedules to a bundle file
+			fmt.Print("Enter path to export bundle to (.yaml or .json): ")
+			path := readUserInput(reader)
+			if err := exportConfigBundle(blockedSitesFilePath, schedulesFilePath, path); err != nil {
+				fmt.Printf("Error exporting bundle: %v\n", err)
+				continue
+			}
+			fmt.Println("Exported configuration bundle to", path)
+		case "19": // Import sites, groups and schedules from a bundle file
+			fmt.Print("Enter path to bundle file: ")
+			path := readUserInput(reader)
+			fmt.Print("Enter import mode (merge/replace): ")
+			mode := FormatString(readUserInput(reader))
+			fmt.Print("Dry run only? (y/n): ")
+			dryRun := FormatString(readUserInput(reader)) != "n"
+			if !dryRun && !authorize(reader, actionImportBundle) {
+				fmt.Println("Access denied")
+				continue
+			}
+			changes, err := importConfigBundle(blockedSitesFilePath, schedulesFilePath, path, mode == "replace", dryRun)
+			if err != nil {
+				fmt.Printf("Error importing bundle: %v\n", err)
+				continue
+			}
+			printBundleChanges(changes, dryRun)
+		case "20": // Only allow the configured domains for a duration
+			fmt.Println("Chosen to start allowlist focus mode")
+			expiryTime := time.Now().Add(getDuration(reader))
+			locked := queryForLock(reader)
+			if err := startAllowlistMode(allowlistFilePath, expiryTime, locked, false); err != nil {
+				fmt.Printf("Error starting allowlist mode: %v\n", err)
+				continue
+			}
+			auditLog(auditAllowlistStart, "", nil, formatStoredTime(expiryTime), "")
+			fmt.Printf("Allowlist mode active until %s\n", formatLocalTime(expiryTime))
+		case "21": // Add domain to allowlist
+			if !authorize(reader, actionAllowDomain) {
+				fmt.Println("Access denied")
+				continue
+			}
+			fmt.Print("Enter domain to allow: ")
+			domain, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid domain: %v\n", err)
+				continue
+			}
+			if err := addAllowedDomain(allowlistFilePath, domain); err != nil {
+				fmt.Printf("Error adding allowed domain: %v\n", err)
+				continue
+			}
+			fmt.Println("Allowed domain: ", domain)
+		case "22": // Remove domain from allowlist
+			fmt.Print("Enter domain to remove from allowlist: ")
+			domain, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid domain: %v\n", err)
+				continue
+			}
+			if err := removeAllowedDomain(allowlistFilePath, domain); err != nil {
+				fmt.Printf("Error removing allowed domain: %v\n", err)
+				continue
+			}
+			fmt.Println("Removed allowed domain: ", domain)
+		case "23": // Lock a blocked site until it expires
+			fmt.Print("Enter site to lock: ")
+			site, err := NormalizeDomain(readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid site: %v\n", err)
+				continue
+			}
+			if err := lockSite(blockedSitesFilePath, site); err != nil {
+				fmt.Printf("Error locking site: %v\n", err)
+				continue
+			}
+			fmt.Println("Locked site until expiry: ", site)
+		case "24": // Cancel pending unblocks
+			cancelled, err := cancelPendingUnblocks(blockedSitesFilePath)
+			if err != nil {
+				fmt.Printf("Error cancelling pending unblocks: %v\n", err)
+				continue
+			}
+			fmt.Printf("Cancelled %d pending unblocks\n", cancelled)
+		case "25": // Enroll TOTP second factor
+			if !authorize(reader, actionEnrollTwoFactor) {
+				fmt.Println("Access denied")
+				continue
+			}
+			if err := enrollTOTP(reader); err != nil {
+				fmt.Printf("Error setting up two-factor authentication: %v\n", err)
+				continue
+			}
+			fmt.Println("Two-factor authentication enabled")
+		case "26": // Set admin secret held by an accountability partner
+			if err := setAdminSecret(reader); err != nil {
+				fmt.Printf("Error setting admin secret: %v\n", err)
+				continue
+			}
+			fmt.Println("Admin secret set, unblocking, shortening and deleting now require it")
+		case "27": // Query the audit log
+			fmt.Print("Filter by action (e.g. unblock, empty for all): ")
+			action := readUserInput(reader)
+			fmt.Print("Filter by site or target (empty for all): ")
+			target := readUserInput(reader)
+			fmt.Print("Only show the last (e.g. 24h, empty for everything): ")
+			filter, err := parseAuditFilter(action, target, readUserInput(reader))
+			if err != nil {
+				fmt.Printf("Invalid filter: %v\n", err)
+				continue
+			}
+			records, err := queryAuditLog(getAuditLogFilePath(), filter)
+			if err != nil {
+				fmt.Printf("Error reading audit log: %v\n", err)
+			}
+			printAuditRecords(records)
+		case "28": // Check the audit log hash chain
+			secret, err := readAuditSecret()
+			if err != nil {
+				fmt.Printf("Error checking audit log: %v\n", err)
+				continue
+			}
+			printAuditVerification(verifyAuditLog(getAuditLogFilePath(), secret))
+		case "29": // Skip a schedule for the rest of today
+			fmt.Print("Enter name of schedule to skip today: ")
+			name := FormatString(readUserInput(reader))
+			if !authorize(reader, actionSkipSchedule) {
+				fmt.Println("Access denied")
+				continue
+			}
+			skipFrom, err := skipScheduleToday(schedulesFilePath, name, time.Now())
+			if err != nil {
+				fmt.Printf("Error skipping schedule: %v\n", err)
+				continue
+			}
+			fmt.Printf("Schedule %s is skipped today from %s, blocks it already started stay until they expire\n", name, formatLocalTime(skipFrom))
+		case "30": // List the next windows of the schedules and calendars
+			fmt.Print("Enter name of schedule, or leave empty for all: ")
+			name := FormatString(readUserInput(reader))
+			fmt.Printf("Enter number of windows to list (default %d): ", defaultPreviewCount)
+			count := defaultPreviewCount
+			if input := readUserInput(reader); input != "" {
+				if n, err := strconv.Atoi(input); err == nil && n > 0 {
+					count = n
+				} else {
+					fmt.Println("Invalid number of windows")
+					continue
+				}
+			}
+			headerSchedule, err := readScheduleYamlFile(schedulesFilePath)
+			if err != nil {
+				fmt.Println("Error reading schedule file: ", err)
+				continue
+			}
+			if err := printScheduleWindows(headerSchedule, name, count); err != nil {
+				fmt.Printf("Error previewing schedules: %v\n", err)
+			}
+		case "31": // Show what is blocked when over the coming week
+			timeline, err := loadTimeline(time.Now())
+			if err != nil {
+				fmt.Printf("Error building timeline: %v\n", err)
+				continue
+			}
+			printTimeline(timeline)
 		default:
 			fmt.Println("Invalid option")
 		}
 	}
 }
 
-// Function to start the application in the background while in main function
-func startBackground() {
-
-	// Truncate nohup.out file
-	_, err := os.Create("nohup.out")
-	if err != nil {
-		fmt.Println("Error truncating nohup.out file:", err)
+// Function to leave the menu without lifting running blocks. Unblocking early needs the admin role, its challenges
+// and the unblock cooldown through "Unblock all sites", so running blocks are handed to a background process instead
+func exitKeepingBlocks() {
+	if blockingSessionActive() {
+		fmt.Println("Sites are still blocked, a background process lifts them when they expire")
+		startBackground()
 		return
 	}
+	// Nothing is blocked, only leftover hosts entries are removed
+	if err := cleanup(true, ""); err != nil {
+		fmt.Printf("Error during cleanup: %v\n", err)
+		if errors.Is(err, errBlockLocked) {
+			// Locked blocks stay in place, keep a background process running to lift them on expiry
+			startBackground()
+		}
+	}
+}
+
+// Function to start the application in the background while in main function
+func startBackground() {
+	flushNotices() // Notices queued by this process would be lost once it exits
 
 	// Get the path to the executable currently running
 	exe, err := os.Executable()
@@ -617,7 +1170,7 @@ func startBackground() {
 		return
 	}
 
-	// Create or open nohup.out file
+	// Anything not going through the logger, such as panics, is appended to nohup.out
 	outFile, err := os.OpenFile("nohup.out", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Println("Error creating output file:", err)
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Actions that are only audited, the others reuse the action names from roles.go
+const (
+	auditAddSite         = "add-site"
+	auditLockSite        = "lock-site"
+	auditUnblockRequest  = "unblock-request"
+	auditCancelUnblock   = "cancel-unblock"
+	auditAddSchedule     = "add-schedule"
+	auditAllowlistStart  = "allowlist-start"
+	auditAllowlistStop   = "allowlist-stop"
+	auditDisallowDomain  = "disallow-domain"
+	auditImportBlocklist = "import-blocklist"
+	auditAuthFailure     = "auth-failure"
+	auditLogin           = "login"
+	auditUseRecoveryCode = "use-recovery-code"
+	auditTamper          = "tamper"
+)
+
+// AuditRecord is one line of the append-only audit log
+type AuditRecord struct {
+	Time   string          `json:"time"`
+	UID    int             `json:"uid"`
+	User   string          `json:"user,omitempty"`
+	TTY    string          `json:"tty,omitempty"`
+	Action string          `json:"action"`
+	Target string          `json:"target,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	Detail string          `json:"detail,omitempty"`
+	Prev   string          `json:"prev"`            // Hash of the previous record, "" for the first one
+	KeyID  string          `json:"keyId,omitempty"` // Admin secret the HMAC is keyed with
+	Hash   string          `json:"hash"`            // SHA-256 of the record without hash and HMAC
+	MAC    string          `json:"mac,omitempty"`   // HMAC-SHA256 of the hash, only when an admin secret is set
+}
+
+// AuditFilter selects audit records, empty fields match everything
+type AuditFilter struct {
+	Action string    // Exact action, e.g. unblock
+	Target string    // Substring of the target, e.g. youtube
+	Since  time.Time // Only records at or after this time
+}
+
+// Serialises writes to the audit log from the timer goroutines
+var auditMu sync.Mutex
+
+// Function to get the audit log, falling back to the absolute path when started by systemd outside the application directory
+func getAuditLogFilePath() string {
+	if _, err := os.Stat(filepath.Dir(auditLogFilePath)); err != nil {
+		return absolutePathToSelfControl + "/" + auditLogFilePath
+	}
+	return auditLogFilePath
+}
+
+// Function to get the audit key file, falling back to the absolute path like the audit log
+func getAuditKeyFilePath() string {
+	if _, err := os.Stat(filepath.Dir(auditKeyFilePath)); err != nil {
+		return absolutePathToSelfControl + "/" + auditKeyFilePath
+	}
+	return auditKeyFilePath
+}
+
+// Function to get the terminal the process was started from, empty when run without one
+func auditTTY() string {
+	tty, err := os.Readlink("/proc/self/fd/0")
+	if err != nil || !(strings.HasPrefix(tty, "/dev/pts/") || strings.HasPrefix(tty, "/dev/tty")) {
+		return ""
+	}
+	return tty
+}
+
+// Function to get the user behind the process, looking through sudo
+func auditUser() string {
+	if user := os.Getenv("SUDO_USER"); user != "" {
+		return user
+	}
+	return os.Getenv("USER")
+}
+
+// Function to encode a before or after value, nil values are left out of the record
+func auditValue(value any) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Function to append a record to the audit log, chained to the previous record.
+// Failing to audit never stops the action itself
+func auditLog(action string, target string, before any, after any, detail string) {
+	if err := writeAuditRecord(newAuditRecord(action, target, before, after, detail), nil); err != nil {
+		fmt.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+// Function to create an audit record for an action by the current user
+func newAuditRecord(action string, target string, before any, after any, detail string) AuditRecord {
+	return AuditRecord{
+		Time:   formatStoredTime(time.Now()),
+		UID:    os.Getuid(),
+		User:   auditUser(),
+		TTY:    auditTTY(),
+		Action: action,
+		Target: target,
+		Before: auditValue(before),
+		After:  auditValue(after),
+		Detail: detail,
+	}
+}
+
+// Function to seal a record and append it to the audit log. The audit key moves on to the key of the next
+// record, or to nextKey when a new key is announced by this record
+func writeAuditRecord(record AuditRecord, nextKey *auditKeyState) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	file, err := os.OpenFile(getAuditLogFilePath(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	// The background process writes to the same log, so lock the file while reading the last hash, moving the key on and appending
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("error locking audit log: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	prev, err := lastAuditHash(file)
+	if err != nil {
+		return fmt.Errorf("error reading audit log: %v", err)
+	}
+	state, err := readAuditKeyState(getAuditKeyFilePath())
+	if err != nil {
+		return fmt.Errorf("error reading audit key: %v", err)
+	}
+	state, err = sealAuditRecord(&record, prev, state)
+	if err != nil {
+		return fmt.Errorf("error sealing audit record: %v", err)
+	}
+	if nextKey != nil {
+		state = *nextKey
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding audit record: %v", err)
+	}
+	// The key of this record is dropped before the record is written, so it cannot be used to re-sign it
+	if state.KeyID != "" {
+		if err := writeAuditKeyState(getAuditKeyFilePath(), state); err != nil {
+			return fmt.Errorf("error saving audit key: %v", err)
+		}
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
+
+// Function to read the audit records matching a filter, oldest first
+func queryAuditLog(filename string, filter AuditFilter) ([]AuditRecord, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024) // Bundle imports can produce long records
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if filter.Action != "" && record.Action != filter.Action {
+			continue
+		}
+		if filter.Target != "" && !strings.Contains(record.Target, filter.Target) {
+			continue
+		}
+		if !filter.Since.IsZero() {
+			recordTime, err := time.Parse(DateTimeLayout, record.Time)
+			if err != nil || recordTime.Before(filter.Since) {
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Function to print audit records, one per line
+func printAuditRecords(records []AuditRecord) {
+	if len(records) == 0 {
+		fmt.Println("No matching audit records")
+		return
+	}
+	for _, record := range records {
+		actor := fmt.Sprintf("uid=%d", record.UID)
+		if record.User != "" {
+			actor += " user=" + record.User
+		}
+		if record.TTY != "" {
+			actor += " tty=" + record.TTY
+		}
+		line := fmt.Sprintf("%s  %-18s %s  [%s]", displayStoredTime(record.Time), record.Action, record.Target, actor)
+		if len(record.Before) > 0 {
+			line += "  before=" + string(record.Before)
+		}
+		if len(record.After) > 0 {
+			line += "  after=" + string(record.After)
+		}
+		if record.Detail != "" {
+			line += "  (" + record.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// Function to build an audit filter from the user input of the menu or the audit command
+func parseAuditFilter(action string, target string, since string) (AuditFilter, error) {
+	filter := AuditFilter{Action: FormatString(action), Target: FormatString(target)}
+	if since != "" {
+		duration, err := time.ParseDuration(since)
+		if err != nil {
+			return AuditFilter{}, fmt.Errorf("invalid duration %q: %v", since, err)
+		}
+		filter.Since = time.Now().Add(-duration)
+	}
+	return filter, nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// AuditVerification summarises a successful check of the audit log hash chain
+type AuditVerification struct {
+	Records    int // Records covered by the hash chain
+	Legacy     int // Records written before the log was hash-chained, at the start of the log
+	MACChecked int // Records whose HMAC was checked against the admin secret
+	Unchecked  int // Keyed records whose HMAC was not checked because no admin secret was given
+	OldKey     int // Records keyed with an earlier admin secret, their HMAC cannot be checked anymore
+}
+
+// auditKeyState is the key the next audit record is signed with. Each record is signed with its own key and the
+// key is replaced by its hash afterwards, so the stored key cannot re-sign records already in the log. The first
+// key is derived from the admin secret, which is not stored, so only the admin secret holder can check the HMACs
+type auditKeyState struct {
+	KeyID string `yaml:"keyId"`
+	Key   string `yaml:"key"` // Hex encoded key for the next record
+}
+
+// auditKeyAnnouncement is stored in the set-admin-secret record to start signing with a new key
+type auditKeyAnnouncement struct {
+	KeyID string `json:"keyId"`
+	Salt  string `json:"salt"`
+}
+
+// Function to read the audit key state, a missing file means records are not signed
+func readAuditKeyState(filename string) (auditKeyState, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return auditKeyState{}, nil
+	}
+	if err != nil {
+		return auditKeyState{}, err
+	}
+	var state auditKeyState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return auditKeyState{}, err
+	}
+	return state, nil
+}
+
+// Function to write the audit key state, readable only by its owner
+func writeAuditKeyState(filename string, state auditKeyState) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// Function to derive the first audit key from the admin secret and the salt of its announcement, and the key id
+func deriveAuditKey(secret string, salt []byte) ([]byte, string) {
+	key := argon2.IDKey([]byte(secret), salt, 3, 64*1024, 2, 32)
+	id := sha256.Sum256(append([]byte("selfcontrol audit key id\x00"), key...))
+	return key, hex.EncodeToString(id[:8])
+}
+
+// Function to get the key of the next record from the key of the current one, the hash cannot be undone
+func nextAuditKey(key []byte) []byte {
+	next := sha256.Sum256(append([]byte("selfcontrol audit key\x00"), key...))
+	return next[:]
+}
+
+// Function to start signing audit records with a key derived from a new admin secret. The record announcing
+// the key is still signed with the previous key, so the change itself is covered by the chain
+func rotateAuditKey(secret string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, keyID := deriveAuditKey(secret, salt)
+	record := newAuditRecord(actionSetAdminSecret, "admin secret", nil, auditKeyAnnouncement{KeyID: keyID, Salt: hex.EncodeToString(salt)}, "")
+	next := auditKeyState{KeyID: keyID, Key: hex.EncodeToString(key)}
+	return writeAuditRecord(record, &next)
+}
+
+// Function to compute the hash of a record over all of its fields except the hash and HMAC themselves
+func auditRecordHash(record AuditRecord) (string, error) {
+	record.Hash = ""
+	record.MAC = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Function to compute the HMAC of a record hash
+func auditRecordMAC(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Function to link a record to the previous one and fill in its hash, and its HMAC if the log is keyed.
+// Returns the key state for the next record
+func sealAuditRecord(record *AuditRecord, prev string, state auditKeyState) (auditKeyState, error) {
+	record.Prev = prev
+	record.KeyID = state.KeyID
+	hash, err := auditRecordHash(*record)
+	if err != nil {
+		return state, err
+	}
+	record.Hash = hash
+	if state.KeyID == "" {
+		return state, nil
+	}
+	key, err := hex.DecodeString(state.Key)
+	if err != nil || len(key) == 0 {
+		return state, fmt.Errorf("audit key is unreadable")
+	}
+	record.MAC = auditRecordMAC(key, hash)
+	state.Key = hex.EncodeToString(nextAuditKey(key))
+	return state, nil
+}
+
+// Function to get the hash of the last record in the audit log, "" for an empty or legacy log.
+// Reads backwards from the end so appending stays cheap as the log grows
+func lastAuditHash(file *os.File) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+	for chunk := int64(4096); ; chunk *= 2 {
+		chunk = min(chunk, size)
+		buffer := make([]byte, chunk)
+		if _, err := file.ReadAt(buffer, size-chunk); err != nil && err != io.EOF {
+			return "", err
+		}
+		buffer = bytes.TrimRight(buffer, "\n")
+		start := bytes.LastIndexByte(buffer, '\n')
+		if start < 0 && chunk < size {
+			continue // The last line is longer than the chunk
+		}
+		line := buffer[start+1:]
+		if len(line) == 0 {
+			return "", nil
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return "", fmt.Errorf("last audit record is unreadable: %v", err)
+		}
+		return record.Hash, nil
+	}
+}
+
+// Function to check the hash chain of the audit log, returns an error naming the first broken record.
+// With the admin secret the HMACs of the records signed since it was set are checked as well
+func verifyAuditLog(filename string, secret string) (AuditVerification, error) {
+	var result AuditVerification
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	prev := ""
+	chained := false
+	keyID, secretKeyID := "", "" // Key announced last in the log, key announced for the given admin secret
+	var key []byte               // Key of the next record when it can be checked
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return result, fmt.Errorf("record on line %d is unreadable: %v", lineNumber, err)
+		}
+		broken := func(reason string) error {
+			return fmt.Errorf("record on line %d (%s %s %s) %s", lineNumber, displayStoredTime(record.Time), record.Action, record.Target, reason)
+		}
+
+		if record.Hash == "" {
+			if chained {
+				return result, broken("has no hash")
+			}
+			result.Legacy++
+			continue
+		}
+		chained = true
+		if record.Prev != prev {
+			return result, broken("does not follow the previous record, records were removed or reordered")
+		}
+		hash, err := auditRecordHash(record)
+		if err != nil {
+			return result, broken(err.Error())
+		}
+		if hash != record.Hash {
+			return result, broken("was modified, its hash does not match")
+		}
+		switch {
+		case record.KeyID != keyID && keyID == "":
+			return result, broken("is signed with a key that was never announced in the log")
+		case record.KeyID != keyID:
+			return result, broken("is not signed with the key announced last, records were added or the audit key was removed")
+		case keyID == "":
+		case key != nil:
+			if !hmac.Equal([]byte(record.MAC), []byte(auditRecordMAC(key, hash))) {
+				return result, broken("has an invalid HMAC")
+			}
+			key = nextAuditKey(key)
+			result.MACChecked++
+		case secret == "":
+			result.Unchecked++
+		default:
+			result.OldKey++
+		}
+
+		// A new admin secret starts a new key from the next record on
+		if record.Action == actionSetAdminSecret {
+			var announcement auditKeyAnnouncement
+			if err := json.Unmarshal(record.After, &announcement); err == nil && announcement.KeyID != "" {
+				keyID, key = announcement.KeyID, nil
+				if salt, err := hex.DecodeString(announcement.Salt); err == nil && secret != "" {
+					if derived, derivedID := deriveAuditKey(secret, salt); derivedID == keyID {
+						key, secretKeyID = derived, keyID
+					}
+				}
+			}
+		}
+		prev = hash
+		result.Records++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	// Records signed with a key of someone else's making would otherwise only count as keyed with an earlier secret
+	if secret != "" && keyID != secretKeyID {
+		return result, fmt.Errorf("the log is not signed with the given admin secret since it was last set")
+	}
+	return result, nil
+}
+
+// Function to ask for the admin secret to check the audit HMACs with, empty to only check the hashes
+func readAuditSecret() (string, error) {
+	hashedBytes, err := os.ReadFile(adminPasswordFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading admin secret: %v", err)
+	}
+	fmt.Print("Enter the admin secret to check the HMACs, or leave empty to check the hashes only: ")
+	input, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("error reading admin secret: %v", err)
+	}
+	secret := strings.TrimSpace(string(input))
+	if secret == "" {
+		return "", nil
+	}
+	if err := authenticate(secret, string(hashedBytes)); err != nil {
+		return "", fmt.Errorf("admin secret rejected: %v", err)
+	}
+	return secret, nil
+}
+
+// Function to print the result of verifying the audit log
+func printAuditVerification(result AuditVerification, err error) {
+	if err != nil {
+		fmt.Printf("Audit log is broken: %v\n", err)
+		return
+	}
+	fmt.Printf("Audit log intact: %d chained records, %d with a verified HMAC\n", result.Records, result.MACChecked)
+	if result.Legacy > 0 {
+		fmt.Printf("%d older records at the start of the log were written before hash chaining and cannot be verified\n", result.Legacy)
+	}
+	if result.Unchecked > 0 {
+		fmt.Printf("%d records are signed, their HMACs can only be checked with the admin secret\n", result.Unchecked)
+	}
+	if result.OldKey > 0 {
+		fmt.Printf("%d records were signed with an earlier admin secret, only their hashes were checked\n", result.OldKey)
+	}
+}
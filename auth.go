@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Session is a short-lived token issued after a successful login, only the token hash is stored
+type Session struct {
+	TokenHash string `yaml:"tokenHash"`
+	Role      string `yaml:"role"`
+	ExpiresAt string `yaml:"expiresAt"`
+}
+
+// Header of the sessions file with all issued sessions
+type HeaderSessions struct {
+	Sessions []Session `yaml:"sessions"`
+}
+
+// Function to read a password from the first line of a non-interactive input such as stdin
+func readPasswordFrom(input io.Reader) (string, error) {
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("error reading password: %v", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Function to check the login password without prompting, with the same rate limiting as the menu
+func loginWithPassword(password string) error {
+	hashedBytes, err := os.ReadFile(getPasswordFilePath())
+	if err != nil {
+		return fmt.Errorf("no password set, create one from the interactive menu first")
+	}
+	if err := authenticate(password, string(hashedBytes)); err != nil {
+		return err
+	}
+	rehashIfOutdated(getPasswordFilePath(), password, string(hashedBytes))
+	if expired, maxAge := passwordExpired(); expired {
+		fmt.Fprintf(os.Stderr, "Warning: password is older than the maximum password age of %s, change it from the interactive menu\n", maxAge)
+	}
+	return nil
+}
+
+// Function to check the credentials for a role without prompting.
+// The admin role needs the admin secret if one is set, and a TOTP code if TOTP is enrolled
+func loginAsRole(role string, password string, code string) error {
+	if role == roleUser {
+		return loginWithPassword(password)
+	}
+	if role != roleAdmin {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	if adminSecretEnabled() {
+		hashedBytes, err := os.ReadFile(adminPasswordFilePath)
+		if err != nil {
+			return fmt.Errorf("error reading admin secret: %v", err)
+		}
+		if err := authenticate(password, string(hashedBytes)); err != nil {
+			return err
+		}
+		rehashIfOutdated(adminPasswordFilePath, password, string(hashedBytes))
+	} else if adminSecretRemoved() && blockingSessionActive() {
+		return fmt.Errorf("the admin secret is missing, the admin role is refused until the block ends")
+	} else if err := loginWithPassword(password); err != nil {
+		return err
+	}
+
+	totpConfig, enrolled, err := readTOTPConfig(totpFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading TOTP config: %v", err)
+	}
+	if enrolled {
+		if err := authenticateCode(func() bool { return verifyTOTPCode(totpConfig.Secret, code) }); err != nil {
+			return fmt.Errorf("valid two-factor code required for the admin role: %w", err)
+		}
+	}
+	return nil
+}
+
+// Function to check if a role grants the permissions of the required role
+func roleSatisfies(role string, required string) bool {
+	return role == required || role == roleAdmin
+}
+
+// Function to get the sessions file, falling back to the absolute path when started by systemd outside the application directory
+func getSessionsFilePath() string {
+	if _, err := os.Stat(filepath.Dir(sessionsFilePath)); err != nil {
+		return absolutePathToSelfControl + "/" + sessionsFilePath
+	}
+	return sessionsFilePath
+}
+
+// Function to hash a session token for storage
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Function to read the sessions file, dropping expired sessions
+func readSessions(filename string) (HeaderSessions, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return HeaderSessions{}, nil
+	}
+	if err != nil {
+		return HeaderSessions{}, err
+	}
+	var headerSessions HeaderSessions
+	if err := yaml.Unmarshal(data, &headerSessions); err != nil {
+		return HeaderSessions{}, err
+	}
+
+	var active []Session
+	for _, session := range headerSessions.Sessions {
+		expiresAt, err := time.Parse(DateTimeLayout, session.ExpiresAt)
+		if err == nil && time.Now().Before(expiresAt) {
+			active = append(active, session)
+		}
+	}
+	headerSessions.Sessions = active
+	return headerSessions, nil
+}
+
+// Function to write the sessions file, readable only by its owner
+func writeSessions(filename string, headerSessions HeaderSessions) error {
+	data, err := yaml.Marshal(headerSessions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// Function to issue a session token for a role after a successful login
+func issueSessionToken(role string) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := "sc_" + base64.RawURLEncoding.EncodeToString(raw)
+
+	ttl := settingsDuration(getSettings().SessionTTL)
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	headerSessions, err := readSessions(getSessionsFilePath())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	headerSessions.Sessions = append(headerSessions.Sessions, Session{
+		TokenHash: hashSessionToken(token),
+		Role:      role,
+		ExpiresAt: formatStoredTime(expiresAt),
+	})
+	if err := writeSessions(getSessionsFilePath(), headerSessions); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Function to look up the session of a token, returns an error if it is unknown or expired
+func validateSessionToken(token string) (Session, error) {
+	headerSessions, err := readSessions(getSessionsFilePath())
+	if err != nil {
+		return Session{}, err
+	}
+	tokenHash := hashSessionToken(token)
+	for _, session := range headerSessions.Sessions {
+		if subtle.ConstantTimeCompare([]byte(session.TokenHash), []byte(tokenHash)) == 1 {
+			return session, nil
+		}
+	}
+	return Session{}, fmt.Errorf("invalid or expired session token")
+}
+
+// Function to revoke a session token
+func revokeSessionToken(token string) error {
+	headerSessions, err := readSessions(getSessionsFilePath())
+	if err != nil {
+		return err
+	}
+	tokenHash := hashSessionToken(token)
+	var remaining []Session
+	for _, session := range headerSessions.Sessions {
+		if session.TokenHash != tokenHash {
+			remaining = append(remaining, session)
+		}
+	}
+	headerSessions.Sessions = remaining
+	return writeSessions(getSessionsFilePath(), headerSessions)
+}
+
+// Function to check if sites are blocked or allowlist mode is running, in which case a missing
+// password file must not be treated as a fresh install
+func blockingSessionActive() bool {
+	headerSites, err := readBlockedYamlFile(blockedSitesFilePath)
+	if err == nil {
+		for _, site := range headerSites.Sites {
+			expiryTime, err := time.Parse(DateTimeLayout, site.Duration)
+			if site.CurrentlyBlocked && err == nil && time.Now().Before(expiryTime) {
+				return true
+			}
+		}
+	}
+	allowlist, err := readAllowlistYamlFile(allowlistFilePath)
+	return err == nil && allowlist.Active
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the bundle format written by exportConfigBundle
+const bundleVersion = 1
+
+// ConfigBundle holds a shareable copy of all sites, groups and schedules
+type ConfigBundle struct {
+	Version    int        `yaml:"version" json:"version"`
+	ExportedAt string     `yaml:"exportedAt" json:"exportedAt"`
+	Sites      []Site     `yaml:"sites" json:"sites"`
+	Groups     []Group    `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Schedules  []Schedule `yaml:"schedules" json:"schedules"`
+}
+
+// BundleChange describes a single difference between the current config and a bundle
+type BundleChange struct {
+	Kind   string `json:"kind"`   // site, group or schedule
+	Action string `json:"action"` // add, update or remove
+	Name   string `json:"name"`
+}
+
+// Function to check if a bundle path should be read and written as JSON
+func isJSONBundle(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Function to export sites, groups and schedules into a single bundle file
+func exportConfigBundle(sitesFile string, schedulesFile string, path string) error {
+	headerSites, err := readBlockedYamlFile(sitesFile)
+	if err != nil {
+		return err
+	}
+	headerSchedule, err := readScheduleYamlFile(schedulesFile)
+	if err != nil {
+		return err
+	}
+
+	// Blocking state is local to this machine, only the profile itself is exported
+	sites := make([]Site, len(headerSites.Sites))
+	for i, site := range headerSites.Sites {
+		sites[i] = bundleSite(site)
+	}
+	schedules := make([]Schedule, len(headerSchedule.Schedules))
+	for i, schedule := range headerSchedule.Schedules {
+		schedules[i] = bundleSchedule(schedule)
+	}
+
+	bundle := ConfigBundle{
+		Version:    bundleVersion,
+		ExportedAt: formatStoredTime(time.Now()),
+		Sites:      sites,
+		Groups:     headerSites.Groups,
+		Schedules:  schedules,
+	}
+
+	var data []byte
+	if isJSONBundle(path) {
+		data, err = json.MarshalIndent(bundle, "", "  ")
+	} else {
+		data, err = yaml.Marshal(bundle)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Function to strip the blocking state of this machine from a site: the expiry, block, lock and pending unblock
+func bundleSite(site Site) Site {
+	return Site{Name: site.Name, URL: site.URL, Group: site.Group}
+}
+
+// Function to strip the skip today state of this machine from a schedule
+func bundleSchedule(schedule Schedule) Schedule {
+	schedule.SkipDate, schedule.SkipFrom = "", ""
+	return schedule
+}
+
+// Function to read a bundle file in either YAML or JSON format
+func readConfigBundle(path string) (ConfigBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigBundle{}, err
+	}
+
+	var bundle ConfigBundle
+	if isJSONBundle(path) {
+		err = json.Unmarshal(data, &bundle)
+	} else {
+		err = yaml.Unmarshal(data, &bundle)
+	}
+	if err != nil {
+		return ConfigBundle{}, err
+	}
+	if bundle.Version < 1 || bundle.Version > bundleVersion {
+		return ConfigBundle{}, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	return bundle, nil
+}
+
+// Function to import a bundle by merging into or replacing the current config.
+// When dryRun is set the config files are left untouched and only the changes are returned
+func importConfigBundle(sitesFile string, schedulesFile string, path string, replace bool, dryRun bool) ([]BundleChange, error) {
+	bundle, err := readConfigBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	unlockSites, err := lockConfigFile(sitesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockSites()
+	unlockSchedules, err := lockConfigFile(schedulesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockSchedules()
+	headerSites, err := readBlockedYamlFile(sitesFile)
+	if err != nil {
+		return nil, err
+	}
+	headerSchedule, err := readScheduleYamlFile(schedulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	newSites, siteChanges, err := mergeBundleSites(headerSites.Sites, bundle.Sites, replace)
+	if err != nil {
+		return nil, err
+	}
+	newGroups, groupChanges := mergeBundleGroups(headerSites.Groups, bundle.Groups, replace)
+	newSchedules, scheduleChanges, err := mergeBundleSchedules(headerSchedule.Schedules, bundle.Schedules, replace)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := append(append(siteChanges, groupChanges...), scheduleChanges...)
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	headerSites.Sites = newSites
+	headerSites.Groups = newGroups
+	if err := writeAndSave(sitesFile, headerSites); err != nil {
+		return nil, err
+	}
+	headerSchedule.Schedules = newSchedules
+	if err := writeAndSave(schedulesFile, headerSchedule); err != nil {
+		return nil, err
+	}
+	mode := "merge"
+	if replace {
+		mode = "replace"
+	}
+	auditLog(actionImportBundle, path, nil, changes, mode)
+	return changes, nil
+}
+
+// Function to merge bundle sites into the current sites, keyed by URL.
+// Local blocking state is kept for sites that already exist
+func mergeBundleSites(current []Site, incoming []Site, replace bool) ([]Site, []BundleChange, error) {
+	var changes []BundleChange
+	incomingByURL := make(map[string]Site)
+	var incomingURLs []string
+	for _, site := range incoming {
+		url, err := NormalizeDomain(site.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid site in bundle: %w", err)
+		}
+		site.URL = url
+		site.Name = FormatString(site.Name)
+		if site.Name == "" {
+			site.Name = GetNameFromURL(url)
+		}
+		if _, exists := incomingByURL[url]; !exists {
+			incomingURLs = append(incomingURLs, url)
+		}
+		incomingByURL[url] = site
+	}
+
+	var merged []Site
+	seen := make(map[string]bool)
+	for _, site := range current {
+		newSite, inBundle := incomingByURL[site.URL]
+		if !inBundle {
+			if replace {
+				if site.CurrentlyBlocked {
+					return nil, nil, fmt.Errorf("site %s is currently blocked, unblock it before replacing the config", site.URL)
+				}
+				changes = append(changes, BundleChange{Kind: "site", Action: "remove", Name: site.URL})
+				continue
+			}
+			merged = append(merged, site)
+			continue
+		}
+		seen[site.URL] = true
+		if site.Name != newSite.Name || site.Group != newSite.Group {
+			changes = append(changes, BundleChange{Kind: "site", Action: "update", Name: site.URL})
+			site.Name = newSite.Name
+			site.Group = newSite.Group
+		}
+		merged = append(merged, site)
+	}
+
+	now := formatStoredTime(time.Now())
+	for _, url := range incomingURLs {
+		if seen[url] {
+			continue
+		}
+		newSite := bundleSite(incomingByURL[url])
+		newSite.Duration = now
+		merged = append(merged, newSite)
+		changes = append(changes, BundleChange{Kind: "site", Action: "add", Name: url})
+	}
+	return merged, changes, nil
+}
+
+// Function to merge bundle groups into the current groups, keyed by name
+func mergeBundleGroups(current []Group, incoming []Group, replace bool) ([]Group, []BundleChange) {
+	var changes []BundleChange
+	incomingByName := make(map[string]Group)
+	for _, group := range incoming {
+		incomingByName[group.Name] = group
+	}
+
+	var merged []Group
+	seen := make(map[string]bool)
+	for _, group := range current {
+		newGroup, inBundle := incomingByName[group.Name]
+		if !inBundle {
+			if replace {
+				changes = append(changes, BundleChange{Kind: "group", Action: "remove", Name: group.Name})
+				continue
+			}
+			merged = append(merged, group)
+			continue
+		}
+		seen[group.Name] = true
+		if group != newGroup {
+			changes = append(changes, BundleChange{Kind: "group", Action: "update", Name: group.Name})
+		}
+		merged = append(merged, newGroup)
+	}
+	for _, group := range incoming {
+		if !seen[group.Name] {
+			seen[group.Name] = true
+			merged = append(merged, group)
+			changes = append(changes, BundleChange{Kind: "group", Action: "add", Name: group.Name})
+		}
+	}
+	return merged, changes
+}
+
+// Function to merge bundle schedules into the current schedules, keyed by name.
+// Locked schedules cannot be changed or removed during their window
+func mergeBundleSchedules(current []Schedule, incoming []Schedule, replace bool) ([]Schedule, []BundleChange, error) {
+	var changes []BundleChange
+	incomingByName := make(map[string]Schedule)
+	for i, schedule := range incoming {
+		normalized, err := normalizeSchedule(bundleSchedule(schedule))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid schedule %q in bundle: %w", schedule.Name, err)
+		}
+		incoming[i] = normalized
+		incomingByName[normalized.Name] = normalized
+	}
+
+	var merged []Schedule
+	seen := make(map[string]bool)
+	for _, schedule := range current {
+		// Compare in the same normalized form as the bundle, so formatting alone does not count as a change
+		normalized, err := normalizeSchedule(schedule)
+		if err != nil {
+			normalized = schedule
+		}
+		newSchedule, inBundle := incomingByName[normalized.Name]
+		if !inBundle {
+			if replace {
+				if isScheduleLockActive(schedule, time.Now()) {
+					return nil, nil, fmt.Errorf("%w: schedule %s cannot be removed during its window", errBlockLocked, schedule.Name)
+				}
+				changes = append(changes, BundleChange{Kind: "schedule", Action: "remove", Name: schedule.Name})
+				continue
+			}
+			merged = append(merged, schedule)
+			continue
+		}
+		seen[normalized.Name] = true
+		// A skip today on this machine stays in place
+		newSchedule.SkipDate, newSchedule.SkipFrom = schedule.SkipDate, schedule.SkipFrom
+		if reflect.DeepEqual(normalized, newSchedule) {
+			merged = append(merged, schedule)
+			continue
+		}
+		if isScheduleLockActive(schedule, time.Now()) {
+			return nil, nil, fmt.Errorf("%w: schedule %s cannot be changed during its window", errBlockLocked, schedule.Name)
+		}
+		changes = append(changes, BundleChange{Kind: "schedule", Action: "update", Name: schedule.Name})
+		merged = append(merged, newSchedule)
+	}
+	for _, schedule := range incoming {
+		if !seen[schedule.Name] {
+			seen[schedule.Name] = true
+			merged = append(merged, schedule)
+			changes = append(changes, BundleChange{Kind: "schedule", Action: "add", Name: schedule.Name})
+		}
+	}
+	return merged, changes, nil
+}
+
+// Function to print the changes made, or that would be made, by a bundle import
+func printBundleChanges(changes []BundleChange, dryRun bool) {
+	if len(changes) == 0 {
+		fmt.Println("Bundle matches current configuration, nothing to change")
+		return
+	}
+	if dryRun {
+		fmt.Println("\n***Changes that would be applied***")
+	} else {
+		fmt.Println("\n***Applied changes***")
+	}
+	symbols := map[string]string{"add": "+", "update": "~", "remove": "-"}
+	for _, change := range changes {
+		fmt.Printf("%s %-8s %s\n", symbols[change.Action], change.Kind, change.Name)
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarSource turns the matching events of a local iCalendar file into blocking windows
+type CalendarSource struct {
+	Name         string   `yaml:"name" json:"name"`
+	File         string   `yaml:"file" json:"file"`                                     // Path of the .ics file, exported or kept in sync by another tool
+	Categories   []string `yaml:"categories,omitempty" json:"categories,omitempty"`     // Events with any of these categories block, compared case-insensitively
+	TitlePattern string   `yaml:"titlePattern,omitempty" json:"titlePattern,omitempty"` // Regular expression, events whose title matches block
+	Mode         string   `yaml:"mode,omitempty" json:"mode,omitempty"`                 // block (default) or allowlist
+	Locked       bool     `yaml:"locked,omitempty" json:"locked,omitempty"`             // Blocks started from an event are locked until it ends
+}
+
+// calendarEvent is a VEVENT of an iCalendar file, recurring events are expanded by calendarEventWindows
+type calendarEvent struct {
+	UID          string
+	Summary      string
+	Categories   []string
+	Cancelled    bool
+	Start        time.Time
+	Duration     time.Duration
+	Rule         *recurrenceRule
+	ExDates      []time.Time
+	RecurrenceID time.Time // Set on events that replace one occurrence of a recurring event
+}
+
+// recurrenceRule is the subset of an RRULE that selfcontrol expands: FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH
+type recurrenceRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []weekdayRule
+	ByMonthDay []int
+	ByMonth    []time.Month
+}
+
+// weekdayRule is a BYDAY entry such as MO, 1MO (first Monday) or -1FR (last Friday)
+type weekdayRule struct {
+	Ordinal int // 0 for every such weekday of the period
+	Weekday time.Weekday
+}
+
+// Weekday codes of iCalendar
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Stops expanding rules that never produce an occurrence in the requested range
+const maxRecurrencePeriods = 100000
+
+// Function to read the events of an iCalendar file
+func readCalendarFile(filename string) ([]calendarEvent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Long lines are folded onto continuation lines starting with a space or tab
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	var event *calendarEvent
+	var end time.Time
+	var hasDuration bool
+	nested := 0 // Depth of components inside the event, such as VALARM
+	for number, line := range lines {
+		name, params, value := parseCalendarLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event, end, hasDuration, nested = &calendarEvent{}, time.Time{}, false, 0
+			continue
+		case event == nil:
+			continue
+		case name == "BEGIN":
+			nested++
+			continue
+		case name == "END" && value != "VEVENT":
+			nested--
+			continue
+		case nested > 0:
+			continue
+		}
+
+		var err error
+		switch name {
+		case "END":
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", event.Summary)
+			}
+			if !hasDuration && !end.IsZero() {
+				event.Duration = end.Sub(event.Start)
+			}
+			events = append(events, *event)
+			event = nil
+		case "UID":
+			event.UID = value
+		case "SUMMARY":
+			event.Summary = unescapeCalendarText(value)
+		case "CATEGORIES":
+			for _, category := range splitCalendarList(value) {
+				event.Categories = append(event.Categories, unescapeCalendarText(category))
+			}
+		case "STATUS":
+			event.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case "DTSTART":
+			event.Start, err = parseCalendarTime(value, params)
+			if params["VALUE"] == "DATE" && end.IsZero() && !hasDuration {
+				event.Duration = 24 * time.Hour // All-day events without an end last the day
+			}
+		case "DTEND":
+			end, err = parseCalendarTime(value, params)
+		case "DURATION":
+			event.Duration, err = parseCalendarDuration(value)
+			hasDuration = true
+		case "RRULE":
+			event.Rule, err = parseRecurrenceRule(value)
+		case "EXDATE":
+			for _, exdate := range strings.Split(value, ",") {
+				var exTime time.Time
+				if exTime, err = parseCalendarTime(exdate, params); err != nil {
+					break
+				}
+				event.ExDates = append(event.ExDates, exTime)
+			}
+		case "RECURRENCE-ID":
+			event.RecurrenceID, err = parseCalendarTime(value, params)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", number+1, name, err)
+		}
+	}
+	return events, nil
+}
+
+// Function to split a content line into its name, parameters and value, e.g. DTSTART;TZID=Europe/Berlin:20261020T090000
+func parseCalendarLine(line string) (string, map[string]string, string) {
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// Function to split a comma separated value, commas escaped with a backslash are kept
+func splitCalendarList(value string) []string {
+	var items []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			current.WriteByte(value[i])
+			current.WriteByte(value[i+1])
+			i++
+			continue
+		}
+		if value[i] == ',' {
+			items = append(items, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteByte(value[i])
+	}
+	return append(items, current.String())
+}
+
+// Function to undo the escaping of a text value
+func unescapeCalendarText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// Function to parse a date or date-time value. Times ending in Z are UTC, times with a TZID are in that
+// zone and other times, including all-day dates, are in local time
+func parseCalendarTime(value string, params map[string]string) (time.Time, error) {
+	location := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		loaded, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", tzid)
+		}
+		location = loaded
+	}
+	value = strings.TrimSpace(value)
+	switch {
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, location)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	}
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+// Function to parse an iCalendar duration such as PT1H30M, P1D or P2W
+func parseCalendarDuration(value string) (time.Duration, error) {
+	pattern := regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	match := pattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var duration time.Duration
+	for i, unit := range units {
+		if match[i+2] != "" {
+			n, _ := strconv.Atoi(match[i+2])
+			duration += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		duration = -duration
+	}
+	return duration, nil
+}
+
+// Function to parse an RRULE value such as FREQ=MONTHLY;BYDAY=1MO;COUNT=10
+func parseRecurrenceRule(value string) (*recurrenceRule, error) {
+	rule := &recurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+		case "UNTIL":
+			rule.Until, err = parseCalendarTime(val, nil)
+			if err == nil && len(val) == 8 {
+				rule.Until = rule.Until.AddDate(0, 0, 1).Add(-time.Second) // A date includes the whole day
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				code := strings.ToUpper(day[max(len(day)-2, 0):])
+				weekday, exists := icalWeekdays[code]
+				if !exists {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				ordinal := 0
+				if prefix := day[:len(day)-2]; prefix != "" {
+					if ordinal, err = strconv.Atoi(prefix); err != nil {
+						return nil, fmt.Errorf("invalid BYDAY %q", day)
+					}
+				}
+				rule.ByDay = append(rule.ByDay, weekdayRule{Ordinal: ordinal, Weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(month)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("invalid BYMONTH %q", month)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(n))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", key, val)
+		}
+	}
+	switch rule.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule.Freq)
+	}
+	if rule.Interval < 1 {
+		return nil, fmt.Errorf("invalid INTERVAL %d", rule.Interval)
+	}
+	return rule, nil
+}
+
+// Function to list the days of a month matching the BYMONTHDAY and BYDAY parts of a rule, defaulting to the day of the month of DTSTART
+func (rule *recurrenceRule) daysInMonth(year int, month time.Month, start time.Time) []int {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	matchesByDay := func(day int) bool {
+		weekday := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()
+		for _, byDay := range rule.ByDay {
+			if byDay.Weekday != weekday {
+				continue
+			}
+			switch {
+			case byDay.Ordinal == 0,
+				byDay.Ordinal > 0 && (day-1)/7+1 == byDay.Ordinal,
+				byDay.Ordinal < 0 && (daysInMonth-day)/7+1 == -byDay.Ordinal:
+				return true
+			}
+		}
+		return false
+	}
+
+	var days []int
+	for day := 1; day <= daysInMonth; day++ {
+		if len(rule.ByMonthDay) > 0 && !slices.Contains(rule.ByMonthDay, day) && !slices.Contains(rule.ByMonthDay, day-daysInMonth-1) {
+			continue
+		}
+		if len(rule.ByDay) > 0 && !matchesByDay(day) {
+			continue
+		}
+		if len(rule.ByMonthDay) == 0 && len(rule.ByDay) == 0 && day != start.Day() {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// Function to list the occurrence start times of a rule in one period, the n-th period after the one of DTSTART
+func (rule *recurrenceRule) periodStarts(start time.Time, n int) []time.Time {
+	hour, minute, second := start.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, start.Location())
+	}
+	monthAllowed := func(month time.Month) bool {
+		return len(rule.ByMonth) == 0 || slices.Contains(rule.ByMonth, month)
+	}
+
+	var starts []time.Time
+	switch rule.Freq {
+	case "DAILY":
+		day := at(start.Year(), start.Month(), start.Day()+n*rule.Interval)
+		weekdayAllowed := len(rule.ByDay) == 0 || slices.ContainsFunc(rule.ByDay, func(byDay weekdayRule) bool { return byDay.Weekday == day.Weekday() })
+		monthDayAllowed := len(rule.ByMonthDay) == 0 || slices.Contains(rule.ByMonthDay, day.Day())
+		if weekdayAllowed && monthDayAllowed && monthAllowed(day.Month()) {
+			starts = append(starts, day)
+		}
+	case "WEEKLY":
+		// Weeks start on Monday
+		monday := at(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7+n*7*rule.Interval)
+		weekdays := []time.Weekday{start.Weekday()}
+		if len(rule.ByDay) > 0 {
+			weekdays = nil
+			for _, byDay := range rule.ByDay {
+				weekdays = append(weekdays, byDay.Weekday)
+			}
+		}
+		for offset := 0; offset < 7; offset++ {
+			day := at(monday.Year(), monday.Month(), monday.Day()+offset)
+			if slices.Contains(weekdays, day.Weekday()) && monthAllowed(day.Month()) {
+				starts = append(starts, day)
+			}
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(n*rule.Interval), 1, 0, 0, 0, 0, start.Location())
+		if monthAllowed(first.Month()) {
+			for _, day := range rule.daysInMonth(first.Year(), first.Month(), start) {
+				starts = append(starts, at(first.Year(), first.Month(), day))
+			}
+		}
+	case "YEARLY":
+		year := start.Year() + n*rule.Interval
+		months := rule.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		for _, month := range months {
+			for _, day := range rule.daysInMonth(year, month, start) {
+				starts = append(starts, at(year, month, day))
+			}
+		}
+		slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+	}
+	return starts
+}
+
+// Function to list the occurrences of an event that overlap from..to, leaving out excluded dates and
+// occurrences replaced by another event with a RECURRENCE-ID
+func calendarEventWindows(event calendarEvent, replaced []time.Time, from time.Time, to time.Time) [][2]time.Time {
+	var windows [][2]time.Time
+	add := func(start time.Time) {
+		excluded := func(t time.Time) bool { return t.Equal(start) }
+		if slices.ContainsFunc(event.ExDates, excluded) || slices.ContainsFunc(replaced, excluded) {
+			return
+		}
+		if end := start.Add(event.Duration); start.Before(to) && end.After(from) {
+			windows = append(windows, [2]time.Time{start, end})
+		}
+	}
+	if event.Rule == nil {
+		add(event.Start)
+		return windows
+	}
+
+	// DTSTART is always the first occurrence, and COUNT includes occurrences that are excluded afterwards
+	rule := event.Rule
+	count := 0
+	next := func(start time.Time) bool {
+		if (!rule.Until.IsZero() && start.After(rule.Until)) || !start.Before(to) {
+			return false
+		}
+		if count++; rule.Count > 0 && count > rule.Count {
+			return false
+		}
+		add(start)
+		return true
+	}
+	if !next(event.Start) {
+		return windows
+	}
+	for n := 0; n < maxRecurrencePeriods; n++ {
+		for _, start := range rule.periodStarts(event.Start, n) {
+			if start.After(event.Start) && !next(start) {
+				return windows
+			}
+		}
+	}
+	return windows
+}
+
+// Function to check if an event matches the categories or title pattern of a calendar source.
+// A source without either matches every event
+func (source CalendarSource) matches(event calendarEvent, titlePattern *regexp.Regexp) bool {
+	if len(source.Categories) == 0 && titlePattern == nil {
+		return true
+	}
+	for _, category := range event.Categories {
+		if slices.ContainsFunc(source.Categories, func(wanted string) bool { return strings.EqualFold(strings.TrimSpace(category), wanted) }) {
+			return true
+		}
+	}
+	return titlePattern != nil && titlePattern.MatchString(event.Summary)
+}
+
+// Function to list the blocking windows of a calendar source that overlap from..to
+func calendarWindows(source CalendarSource, from time.Time, to time.Time) ([]scheduleWindow, error) {
+	var titlePattern *regexp.Regexp
+	if source.TitlePattern != "" {
+		var err error
+		if titlePattern, err = regexp.Compile(source.TitlePattern); err != nil {
+			return nil, fmt.Errorf("calendar %s: invalid title pattern: %v", source.Name, err)
+		}
+	}
+	events, err := readCalendarFile(source.File)
+	if err != nil {
+		return nil, fmt.Errorf("calendar %s: %v", source.Name, err)
+	}
+
+	// Occurrences replaced by events with a RECURRENCE-ID, by UID
+	replaced := make(map[string][]time.Time)
+	for _, event := range events {
+		if !event.RecurrenceID.IsZero() {
+			replaced[event.UID] = append(replaced[event.UID], event.RecurrenceID)
+		}
+	}
+
+	mode := source.Mode
+	if mode == "" {
+		mode = scheduleModeBlock
+	}
+	var windows []scheduleWindow
+	for _, event := range events {
+		if event.Cancelled || event.Duration <= 0 || !source.matches(event, titlePattern) {
+			continue
+		}
+		var eventReplaced []time.Time
+		if event.RecurrenceID.IsZero() {
+			eventReplaced = replaced[event.UID]
+		}
+		for _, window := range calendarEventWindows(event, eventReplaced, from, to) {
+			windows = append(windows, scheduleWindow{
+				Name:   source.Name,
+				Title:  event.Summary,
+				Mode:   mode,
+				Locked: source.Locked,
+				Start:  window[0],
+				End:    window[1],
+			})
+		}
+	}
+	slices.SortFunc(windows, func(a, b scheduleWindow) int { return a.Start.Compare(b.Start) })
+	return windows, nil
+}
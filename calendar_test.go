@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarEventWindows(t *testing.T) {
+	tests := []struct {
+		name   string
+		event  []string
+		from   string
+		to     string
+		starts []string
+	}{
+		{
+			name:   "last Friday of the month",
+			event:  []string{"DTSTART:20260130T090000", "DURATION:PT1H", "RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=4"},
+			from:   "2026-01-01",
+			to:     "2027-01-01",
+			starts: []string{"2026-01-30 09:00", "2026-02-27 09:00", "2026-03-27 09:00", "2026-04-24 09:00"},
+		},
+		{
+			name:   "count includes excluded dates",
+			event:  []string{"DTSTART:20260105T080000", "DTEND:20260105T090000", "RRULE:FREQ=DAILY;COUNT=5", "EXDATE:20260106T080000,20260108T080000"},
+			from:   "2026-01-01",
+			to:     "2026-02-01",
+			starts: []string{"2026-01-05 08:00", "2026-01-07 08:00", "2026-01-09 08:00"},
+		},
+		{
+			name:   "until as a date includes that day",
+			event:  []string{"DTSTART:20260105T180000", "DURATION:PT2H", "RRULE:FREQ=WEEKLY;UNTIL=20260119"},
+			from:   "2026-01-01",
+			to:     "2026-03-01",
+			starts: []string{"2026-01-05 18:00", "2026-01-12 18:00", "2026-01-19 18:00"},
+		},
+		{
+			name:   "only occurrences in range",
+			event:  []string{"DTSTART:20260105T180000", "DURATION:PT2H", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE"},
+			from:   "2026-01-12",
+			to:     "2026-01-19",
+			starts: []string{"2026-01-12 18:00", "2026-01-14 18:00"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := append([]string{"BEGIN:VCALENDAR", "BEGIN:VEVENT", "SUMMARY:Focus"}, test.event...)
+			lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+			filename := filepath.Join(t.TempDir(), "focus.ics")
+			if err := os.WriteFile(filename, []byte(strings.Join(lines, "\r\n")), 0600); err != nil {
+				t.Fatal(err)
+			}
+			events, err := readCalendarFile(filename)
+			if err != nil {
+				t.Fatalf("readCalendarFile: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			from, _ := time.ParseInLocation("2006-01-02", test.from, time.Local)
+			to, _ := time.ParseInLocation("2006-01-02", test.to, time.Local)
+			var starts []string
+			for _, window := range calendarEventWindows(events[0], nil, from, to) {
+				starts = append(starts, window[0].Format("2006-01-02 15:04"))
+			}
+			if !slices.Equal(starts, test.starts) {
+				t.Errorf("got starts %v, want %v", starts, test.starts)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	for _, value := range []string{"FREQ=HOURLY", "FREQ=DAILY;INTERVAL=0", "FREQ=MONTHLY;BYDAY=XX", "FREQ=MONTHLY;BYMONTHDAY=32"} {
+		if _, err := parseRecurrenceRule(value); err == nil {
+			t.Errorf("parseRecurrenceRule(%q) succeeded, want an error", value)
+		}
+	}
+}
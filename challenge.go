@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Challenge is a friction task that has to be completed before unblocking or shortening a block
+type Challenge interface {
+	Name() string
+	Run(reader *bufio.Reader, action string, target string) error
+}
+
+// ChallengeConfig configures a challenge for a group of sites in settings.yaml
+type ChallengeConfig struct {
+	Group    string `yaml:"group"`              // Group the challenge applies to, "" for sites without a group and "*" for every site
+	Type     string `yaml:"type"`               // One of the keys of challengeTypes
+	Length   int    `yaml:"length,omitempty"`   // Number of characters for random-string
+	Count    int    `yaml:"count,omitempty"`    // Number of problems for arithmetic
+	MinWords int    `yaml:"minWords,omitempty"` // Minimum words for justification
+}
+
+// Registry of challenge constructors, new challenge types only need to be added here
+var challengeTypes = map[string]func(ChallengeConfig) Challenge{
+	"random-string": newRandomStringChallenge,
+	"arithmetic":    newArithmeticChallenge,
+	"justification": newJustificationChallenge,
+}
+
+// Function to generate a random number in [0, max) using crypto/rand
+func randomInt(max int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		panic(err)
+	}
+	return int(n.Int64())
+}
+
+// Challenge to type a long random string exactly
+type randomStringChallenge struct {
+	length int
+}
+
+func newRandomStringChallenge(config ChallengeConfig) Challenge {
+	if config.Length <= 0 {
+		config.Length = 40
+	}
+	return randomStringChallenge{length: config.Length}
+}
+
+func (c randomStringChallenge) Name() string {
+	return "random-string"
+}
+
+func (c randomStringChallenge) Run(reader *bufio.Reader, action string, target string) error {
+	const charset = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	var builder strings.Builder
+	for i := 0; i < c.length; i++ {
+		builder.WriteByte(charset[randomInt(len(charset))])
+	}
+	text := builder.String()
+	fmt.Printf("Type the following text exactly:\n%s\n> ", text)
+	if readUserInput(reader) != text {
+		return fmt.Errorf("text did not match")
+	}
+	return nil
+}
+
+// Challenge to solve a number of arithmetic problems
+type arithmeticChallenge struct {
+	count int
+}
+
+func newArithmeticChallenge(config ChallengeConfig) Challenge {
+	if config.Count <= 0 {
+		config.Count = 3
+	}
+	return arithmeticChallenge{count: config.Count}
+}
+
+func (c arithmeticChallenge) Name() string {
+	return "arithmetic"
+}
+
+func (c arithmeticChallenge) Run(reader *bufio.Reader, action string, target string) error {
+	for i := 0; i < c.count; i++ {
+		a, b := randomInt(90)+10, randomInt(90)+10
+		var answer int
+		var question string
+		if randomInt(2) == 0 {
+			question, answer = fmt.Sprintf("%d x %d", a, b), a*b
+		} else {
+			base := randomInt(900) + 100
+			question, answer = fmt.Sprintf("%d + %d - %d", base, a, b), base+a-b
+		}
+		fmt.Printf("Problem %d/%d: %s = ", i+1, c.count, question)
+		input, err := strconv.Atoi(readUserInput(reader))
+		if err != nil || input != answer {
+			return fmt.Errorf("wrong answer")
+		}
+	}
+	return nil
+}
+
+// Challenge to write a justification that is kept in the justification log
+type justificationChallenge struct {
+	minWords int
+}
+
+func newJustificationChallenge(config ChallengeConfig) Challenge {
+	if config.MinWords <= 0 {
+		config.MinWords = 20
+	}
+	return justificationChallenge{minWords: config.MinWords}
+}
+
+func (c justificationChallenge) Name() string {
+	return "justification"
+}
+
+func (c justificationChallenge) Run(reader *bufio.Reader, action string, target string) error {
+	fmt.Printf("Explain why you need to %s %s (at least %d words):\n> ", action, target, c.minWords)
+	justification := readUserInput(reader)
+	if words := len(strings.Fields(justification)); words < c.minWords {
+		return fmt.Errorf("justification has %d words, at least %d required", words, c.minWords)
+	}
+
+	file, err := os.OpenFile(justificationLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening justification log: %v", err)
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintf(file, "%s\t%s\t%s\t%s\n", formatStoredTime(time.Now()), action, target, justification); err != nil {
+		return fmt.Errorf("error writing justification log: %v", err)
+	}
+	return nil
+}
+
+// Function to build the challenges configured for any of the given groups
+func challengesForGroups(configs []ChallengeConfig, groups []string) ([]Challenge, error) {
+	wanted := make(map[string]bool)
+	for _, group := range groups {
+		wanted[group] = true
+	}
+
+	var challenges []Challenge
+	for _, config := range configs {
+		if config.Group != "*" && !wanted[FormatString(config.Group)] {
+			continue
+		}
+		constructor, exists := challengeTypes[config.Type]
+		if !exists {
+			return nil, fmt.Errorf("unknown challenge type %q in settings", config.Type)
+		}
+		challenges = append(challenges, constructor(config))
+	}
+	return challenges, nil
+}
+
+// Error for callers without anyone at the terminal to answer the challenges, such as commands and the API
+var errChallengeRequired = errors.New("challenges are configured for these sites, use the interactive menu")
+
+// Function to refuse an action that needs challenges, so they cannot be skipped by scripting it
+func refuseChallenges(groups []string) error {
+	challenges, err := challengesForGroups(getSettings().Challenges, groups)
+	if err != nil {
+		return err
+	}
+	if len(challenges) > 0 {
+		return errChallengeRequired
+	}
+	return nil
+}
+
+// Function to run every challenge configured for the groups of the affected sites.
+// action and target describe what is being done, e.g. "unblock" and "www.youtube.com"
+func runChallenges(reader *bufio.Reader, groups []string, action string, target string) error {
+	challenges, err := challengesForGroups(getSettings().Challenges, groups)
+	if err != nil {
+		return err
+	}
+	for i, challenge := range challenges {
+		fmt.Printf("\nChallenge %d/%d (%s) before you %s %s\n", i+1, len(challenges), challenge.Name(), action, target)
+		if err := challenge.Run(reader, action, target); err != nil {
+			return fmt.Errorf("%s challenge failed: %w", challenge.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Function to check if a new expiry time would shorten the current block on a site
+func isExpiryReduction(filename string, url string, newExpiryTime time.Time) bool {
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return false
+	}
+	for _, site := range headerSites.Sites {
+		if site.URL == url && site.CurrentlyBlocked {
+			currentExpiry, err := time.Parse(DateTimeLayout, site.Duration)
+			return err == nil && newExpiryTime.Before(currentExpiry)
+		}
+	}
+	return false
+}
+
+// Function to get the groups of the currently blocked sites, ungrouped sites are reported as ""
+func blockedSiteGroups(filename string, all bool, url string) []string {
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return nil
+	}
+	var groups []string
+	seen := make(map[string]bool)
+	for _, site := range headerSites.Sites {
+		if (!all && site.URL != url) || !site.CurrentlyBlocked || seen[site.Group] {
+			continue
+		}
+		seen[site.Group] = true
+		groups = append(groups, site.Group)
+	}
+	return groups
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Options for running a single command without the interactive menu
+type cliOptions struct {
+	passwordStdin bool
+	token         string
+	role          string
+	code          string
+}
+
+// Function to parse the command line, returns the options and the command with its arguments
+func parseCommandLine(args []string) (cliOptions, []string, error) {
+	var options cliOptions
+	flags := flag.NewFlagSet("selfcontrol", flag.ContinueOnError)
+	flags.BoolVar(&options.passwordStdin, "password-stdin", false, "read the password (or admin secret) from the first line of stdin")
+	flags.StringVar(&options.token, "token", os.Getenv("SELFCONTROL_TOKEN"), "session token from the login command, defaults to $SELFCONTROL_TOKEN")
+	flags.StringVar(&options.role, "role", roleUser, "role to log in as, user or admin")
+	flags.StringVar(&options.code, "code", "", "TOTP code, required to log in as admin when two-factor authentication is enabled")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: selfcontrol [flags] [login | logout | status | block <duration> | unblock <site|all> | skip-today <schedule> | preview [--count n] [schedule] | timeline [--json] [--from YYYY-MM-DD] | audit [--action a] [--target t] [--since d] | audit-verify | openapi]")
+		fmt.Fprintln(flags.Output(), "Without a command the interactive menu is started.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return cliOptions{}, nil, err
+	}
+	return options, flags.Args(), nil
+}
+
+// Function to authenticate a command with a session token or a password from stdin.
+// Returns an error if the resulting role does not grant the required role
+func authenticateCommand(options cliOptions, required string) error {
+	if options.token != "" {
+		session, err := validateSessionToken(options.token)
+		if err != nil {
+			return err
+		}
+		if !roleSatisfies(session.Role, required) {
+			return fmt.Errorf("session has the %s role, %s required", session.Role, required)
+		}
+		return nil
+	}
+	if !options.passwordStdin {
+		return fmt.Errorf("authentication required, use --password-stdin or --token")
+	}
+
+	password, err := readPasswordFrom(os.Stdin)
+	if err != nil {
+		return err
+	}
+	role := options.role
+	if !roleSatisfies(role, required) {
+		role = required
+	}
+	return loginAsRole(role, password, options.code)
+}
+
+// Function to run a single command, returns the process exit code
+func runCommand(options cliOptions, args []string) int {
+	err := executeCommand(options, args)
+	flushNotices()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// Function to execute a command, each command authenticates with the role its action requires
+func executeCommand(options cliOptions, args []string) error {
+	switch args[0] {
+	case "login": // Issue a session token for API clients and scripts
+		if !options.passwordStdin {
+			return fmt.Errorf("login needs --password-stdin")
+		}
+		password, err := readPasswordFrom(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err := loginAsRole(options.role, password, options.code); err != nil {
+			return err
+		}
+		token, expiresAt, err := issueSessionToken(options.role)
+		if err != nil {
+			return fmt.Errorf("error issuing session token: %v", err)
+		}
+		auditLog(auditLogin, options.role, nil, nil, "session token issued until "+formatStoredTime(expiresAt))
+		fmt.Println(token)
+		fmt.Fprintf(os.Stderr, "Session token for the %s role valid until %s\n", options.role, formatLocalTime(expiresAt))
+		return nil
+
+	case "logout":
+		if options.token == "" {
+			return fmt.Errorf("logout needs --token")
+		}
+		return revokeSessionToken(options.token)
+
+	case "status":
+		if err := authenticateCommand(options, roleUser); err != nil {
+			return err
+		}
+		displayStatus(blockedSitesFilePath)
+		return nil
+
+	case "block": // Block every site for a duration, the same as menu option 1 without a lock
+		if len(args) != 2 {
+			return fmt.Errorf("usage: block <duration>")
+		}
+		duration, err := time.ParseDuration(args[1])
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid duration %q", args[1])
+		}
+		if err := authenticateCommand(options, actionRoles[actionBlock]); err != nil {
+			return err
+		}
+		expiryTime := time.Now().Add(duration)
+		headerSites, err := readBlockedYamlFile(blockedSitesFilePath)
+		if err != nil {
+			return err
+		}
+		extendAllExpiries(blockedSitesFilePath, headerSites, expiryTime)
+		if err := blockSites(true, blockedSitesFilePath, "", expiryTime, false); err != nil {
+			return err
+		}
+		auditLog(actionBlock, "all", nil, formatStoredTime(expiryTime), "command line")
+		notifyBlockEvent(webhookBlockStart, "all", formatLocalTime(expiryTime), "command line")
+		startBackground()
+		return nil
+
+	case "unblock": // Request an unblock, subject to the unblock cooldown
+		if len(args) != 2 {
+			return fmt.Errorf("usage: unblock <site|all>")
+		}
+		all := args[1] == "all"
+		site := ""
+		if !all {
+			normalized, err := NormalizeDomain(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid site: %v", err)
+			}
+			site = normalized
+		}
+		if err := authenticateCommand(options, actionRoles[actionUnblock]); err != nil {
+			return err
+		}
+		if err := refuseChallenges(blockedSiteGroups(blockedSitesFilePath, all, site)); err != nil {
+			return err
+		}
+		pendingUntil, err := requestUnblock(blockedSitesFilePath, all, site)
+		if err != nil {
+			return err
+		}
+		if !pendingUntil.IsZero() {
+			fmt.Printf("Unblock requested, it will be carried out at %s unless cancelled\n", formatLocalTime(pendingUntil))
+		} else {
+			fmt.Println("Unblocked")
+		}
+		// Restart the background process so it picks up the pending unblock or drops the unblocked sites
+		startBackground()
+		return nil
+
+	case "skip-today": // Skip a schedule for the rest of today, subject to the unblock cooldown
+		if len(args) != 2 {
+			return fmt.Errorf("usage: skip-today <schedule>")
+		}
+		if err := authenticateCommand(options, actionRoles[actionSkipSchedule]); err != nil {
+			return err
+		}
+		name := FormatString(args[1])
+		skipFrom, err := skipScheduleToday(schedulesFilePath, name, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schedule %s is skipped today from %s\n", name, formatLocalTime(skipFrom))
+		return nil
+
+	case "preview": // List the next windows of the schedules and calendars, e.g. preview --count 5 work
+		previewFlags := flag.NewFlagSet("preview", flag.ContinueOnError)
+		count := previewFlags.Int("count", defaultPreviewCount, "number of windows to list")
+		if err := previewFlags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *count <= 0 || previewFlags.NArg() > 1 {
+			return fmt.Errorf("usage: preview [--count n] [schedule]")
+		}
+		if err := authenticateCommand(options, roleUser); err != nil {
+			return err
+		}
+		headerSchedule, err := readScheduleYamlFile(schedulesFilePath)
+		if err != nil {
+			return fmt.Errorf("error reading schedule file: %v", err)
+		}
+		return printScheduleWindows(headerSchedule, FormatString(previewFlags.Arg(0)), *count)
+
+	case "timeline": // Show what is blocked when over a week, e.g. timeline --json --from 2026-11-02
+		timelineFlags := flag.NewFlagSet("timeline", flag.ContinueOnError)
+		asJSON := timelineFlags.Bool("json", false, "print the timeline as JSON")
+		fromDate := timelineFlags.String("from", "", "first day of the week, defaults to today")
+		if err := timelineFlags.Parse(args[1:]); err != nil {
+			return err
+		}
+		from := time.Now()
+		if *fromDate != "" {
+			parsed, err := time.ParseInLocation(dateLayout, *fromDate, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", *fromDate)
+			}
+			from = parsed
+		}
+		if err := authenticateCommand(options, roleUser); err != nil {
+			return err
+		}
+		timeline, err := loadTimeline(from)
+		if err != nil {
+			return err
+		}
+		if !*asJSON {
+			printTimeline(timeline)
+			return nil
+		}
+		output, err := json.MarshalIndent(timeline, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+
+	case "audit": // Query the audit log, e.g. audit --action unblock --since 24h
+		queryFlags := flag.NewFlagSet("audit", flag.ContinueOnError)
+		action := queryFlags.String("action", "", "only show records of this action, e.g. unblock")
+		target := queryFlags.String("target", "", "only show records whose target contains this text")
+		since := queryFlags.String("since", "", "only show records from this long ago, e.g. 24h")
+		if err := queryFlags.Parse(args[1:]); err != nil {
+			return err
+		}
+		filter, err := parseAuditFilter(*action, *target, *since)
+		if err != nil {
+			return err
+		}
+		if err := authenticateCommand(options, roleUser); err != nil {
+			return err
+		}
+		records, err := queryAuditLog(getAuditLogFilePath(), filter)
+		if err != nil {
+			return fmt.Errorf("error reading audit log: %v", err)
+		}
+		printAuditRecords(records)
+		return nil
+
+	case "audit-verify": // Check the audit log hash chain, exits non-zero if it is broken
+		// The HMACs are checked when the admin secret is given with --role admin --password-stdin
+		secret := ""
+		if options.passwordStdin && options.role == roleAdmin && adminSecretEnabled() {
+			password, err := readPasswordFrom(os.Stdin)
+			if err != nil {
+				return err
+			}
+			if err := loginAsRole(roleAdmin, password, options.code); err != nil {
+				return err
+			}
+			secret = password
+		} else if err := authenticateCommand(options, roleUser); err != nil {
+			return err
+		}
+		result, err := verifyAuditLog(getAuditLogFilePath(), secret)
+		printAuditVerification(result, err)
+		if err != nil {
+			return fmt.Errorf("audit log verification failed")
+		}
+		return nil
+
+	case "openapi": // Print the OpenAPI description of the REST API
+		spec, err := json.MarshalIndent(openAPISpec(apiRoutes()), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(spec))
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
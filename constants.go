@@ -1,14 +1,64 @@
 package main
 
+import "time"
+
 const (
 	DateTimeLayout            = "2006-01-02 15:04:05 -0700"
+	dateLayout                = "2006-01-02"
 	hostsFile                 = "/etc/hosts"
 	blockedSitesFilePathRoot  = "/home/ivan/work/voyager/selfcontrol/configs/blocked-sites.yaml"
 	blockedSitesFilePath      = "configs/blocked-sites.yaml"
 	schedulesFilePath         = "configs/schedules.yaml"
+	holidaysFilePath          = "configs/holidays.txt"
+	allowlistFilePath         = "configs/allowlist.yaml"
+	settingsFilePath          = "configs/settings.yaml"
+	justificationLogPath      = "configs/justifications.log"
+	authStateFilePath         = "configs/.auth-state"
+	auditLogFilePath          = "configs/audit.log"
+	auditKeyFilePath          = "configs/.audit-key"
+	metricsFilePath           = "configs/.metrics"
+	totpFilePath              = "configs/.totp"
+	adminPasswordFilePath     = "configs/.admin-password"
+	sessionsFilePath          = "configs/.sessions"
 	passwordFilePath          = "configs/.password"
 	lockFilePath              = "tmp/selfcontrol.lock"
 	absolutePathToSelfControl = "placeholder" //update this to your path to selfcontrol app
+	allowlistChain            = "SELFCONTROL_ALLOW"
+	allowlistContextKey       = "allowlist-mode" // Key of the allowlist goroutine in goroutineContexts
+	allowlistRefreshInterval  = 5 * time.Minute
+	scheduleModeBlock         = "block"
+	scheduleModeAllowlist     = "allowlist"
+	hashAlgorithmArgon2id     = "argon2id"
+	hashAlgorithmBcrypt       = "bcrypt"
+	passwordBackoffBase       = 1 * time.Second // Delay after the first failed password attempt, doubled after each further failure
+	passwordBackoffMax        = 1 * time.Minute
+	defaultPasswordAttempts   = 5
+	defaultPasswordLockout    = 15 * time.Minute
+	totpIssuer                = "SelfControl"
+	totpPeriod                = 30 * time.Second
+	totpRecoveryCodeCount     = 8
+	defaultSessionTTL         = 15 * time.Minute
+	tamperCheckInterval       = 30 * time.Second // How often site goroutines check their hosts entry is still in place
+	logFilePath               = "configs/selfcontrol.log"
+	defaultLogMaxSize         = 5 * 1024 * 1024 // Size at which the log file is rotated
+	defaultLogMaxFiles        = 3
+	unblockCauseExpired       = "expired"  // The block ran until its expiry time
+	unblockCauseCooldown      = "cooldown" // A requested unblock was carried out after the cooldown
+	unblockCauseManual        = "manual"   // Unblocked before expiry without a cooldown
+	unblockCauseAll           = "all"      // Everything was unblocked at once, e.g. on exit
+	webhookSpoolDir           = "configs/webhook-spool"
+	webhookAttempts           = 3               // Delivery attempts before an event is left in the spool
+	webhookRetryDelay         = 2 * time.Second // Delay after the first failed attempt, doubled after each further failure
+	webhookTimeout            = 10 * time.Second
+	webhookSpoolInterval      = 1 * time.Minute // How often spooled events are retried
+	defaultNoticeLeadTime     = 5 * time.Minute
+	scheduleNoticeInterval    = 30 * time.Second // How often upcoming schedule windows are checked for notices
+	noticeCoalesceDelay       = 1 * time.Second  // Notices of the same kind within this delay are sent as one
+	notificationTimeout       = 5 * time.Second
+	defaultPreviewCount       = 10
+	previewHorizon            = 2 * 366 * 24 * time.Hour // How far ahead the preview looks for windows
+	timelineDays              = 7
+	timelineCell              = 30 * time.Minute // Length of a cell in the timeline grid
 )
 
 var daysOfWeek = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronExpression is a parsed five field cron expression: minute, hour, day of month, month and day of week.
+// Each field is a bitset of the values it allows
+type cronExpression struct {
+	Minutes     uint64
+	Hours       uint64
+	DaysOfMonth uint64
+	Months      uint64
+	DaysOfWeek  uint64
+	NthWeekdays []weekdayRule // MON#1 (first Monday) or 5L (last Friday) in the day of week field
+	LastDay     bool          // L in the day of month field
+	// Like cron, a day matches either day field when both are restricted
+	DayOfMonthSet bool
+	DayOfWeekSet  bool
+}
+
+// Shorthands for common expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// Function to parse a cron expression such as "30 8 * * MON-FRI", "0 9 * * MON#1" or "@daily"
+func parseCron(expression string) (cronExpression, error) {
+	expression = strings.TrimSpace(expression)
+	if macro, exists := cronMacros[strings.ToLower(expression)]; exists {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronExpression{}, fmt.Errorf("cron expression %q needs 5 fields: minute hour day-of-month month day-of-week", expression)
+	}
+
+	var cron cronExpression
+	var err error
+	if cron.Minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("minute: %v", err)
+	}
+	if cron.Hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("hour: %v", err)
+	}
+	cron.DayOfMonthSet = fields[2] != "*" && fields[2] != "?"
+	if strings.EqualFold(fields[2], "L") {
+		cron.LastDay = true
+	} else if cron.DaysOfMonth, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("day of month: %v", err)
+	}
+	if cron.Months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return cronExpression{}, fmt.Errorf("month: %v", err)
+	}
+	cron.DayOfWeekSet = fields[4] != "*" && fields[4] != "?"
+	if err := cron.parseDaysOfWeek(fields[4]); err != nil {
+		return cronExpression{}, fmt.Errorf("day of week: %v", err)
+	}
+	return cron, nil
+}
+
+// Function to parse the day of week field, where entries can also pick the nth (MON#2) or last (FRIL, 5L) weekday of the month
+func (cron *cronExpression) parseDaysOfWeek(field string) error {
+	var plain []string
+	for _, part := range strings.Split(strings.ToUpper(field), ",") {
+		day, ordinal, nth := strings.Cut(part, "#")
+		if !nth && strings.HasSuffix(part, "L") {
+			day, ordinal, nth = strings.TrimSuffix(part, "L"), "-1", true
+		}
+		if !nth {
+			plain = append(plain, part)
+			continue
+		}
+		weekday, err := parseCronValue(day, 0, 7, cronWeekdayNames)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(ordinal)
+		if err != nil || n == 0 || n < -1 || n > 5 {
+			return fmt.Errorf("invalid weekday number in %q, expected 1 to 5", part)
+		}
+		cron.NthWeekdays = append(cron.NthWeekdays, weekdayRule{Ordinal: n, Weekday: time.Weekday(weekday % 7)})
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	days, err := parseCronField(strings.Join(plain, ","), 0, 7, cronWeekdayNames)
+	if err != nil {
+		return err
+	}
+	// Both 0 and 7 are Sunday
+	if days&(1<<7) != 0 {
+		days |= 1
+	}
+	cron.DaysOfWeek = days
+	return nil
+}
+
+// Function to parse a comma separated cron field of values, ranges (1-5), steps (*/15, 10-50/20) and names into a bitset
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(strings.ToUpper(field), ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		low, high := min, max
+		if valueRange != "*" && valueRange != "?" {
+			first, last, isRange := strings.Cut(valueRange, "-")
+			var err error
+			if low, err = parseCronValue(first, min, max, names); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseCronValue(last, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = max // 5/15 means from 5 on, every 15
+			}
+			if high < low {
+				return 0, fmt.Errorf("range %q ends before it starts", part)
+			}
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// Function to parse a single cron value, a number between min and max or one of the names
+func parseCronValue(value string, min int, max int, names map[string]int) (int, error) {
+	if number, exists := names[value]; exists {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		return 0, fmt.Errorf("invalid value %q, expected %d to %d", value, min, max)
+	}
+	return number, nil
+}
+
+// Function to check if the expression runs on the day of the given time
+func (cron cronExpression) matchesDay(day time.Time) bool {
+	if cron.Months&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	dayOfMonth := cron.DaysOfMonth&(1<<day.Day()) != 0 || (cron.LastDay && day.Day() == lastDay)
+	dayOfWeek := cron.DaysOfWeek&(1<<int(day.Weekday())) != 0
+	for _, nth := range cron.NthWeekdays {
+		if nth.Weekday != day.Weekday() {
+			continue
+		}
+		if (nth.Ordinal > 0 && (day.Day()-1)/7+1 == nth.Ordinal) || (nth.Ordinal < 0 && day.Day()+7 > lastDay) {
+			dayOfWeek = true
+		}
+	}
+	switch {
+	case cron.DayOfMonthSet && cron.DayOfWeekSet:
+		return dayOfMonth || dayOfWeek
+	case cron.DayOfMonthSet:
+		return dayOfMonth
+	case cron.DayOfWeekSet:
+		return dayOfWeek
+	}
+	return true
+}
+
+// Function to list the times the expression fires on the day of the given time
+func (cron cronExpression) startsOn(day time.Time) []time.Time {
+	if !cron.matchesDay(day) {
+		return nil
+	}
+	var starts []time.Time
+	for hour := 0; hour < 24; hour++ {
+		if cron.Hours&(1<<hour) == 0 {
+			continue
+		}
+		for minute := 0; minute < 60; minute++ {
+			if cron.Minutes&(1<<minute) == 0 {
+				continue
+			}
+			// Times skipped by a daylight saving change all start when the clocks jump
+			if start := wallClockTime(day, hour, minute); len(starts) == 0 || !starts[len(starts)-1].Equal(start) {
+				starts = append(starts, start)
+			}
+		}
+	}
+	return starts
+}
+
+// Function to parse the length of a cron schedule's windows, up to a day
+func parseWindowDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, e.g. 2h or 90m", value)
+	}
+	if duration <= 0 || duration > 24*time.Hour {
+		return 0, fmt.Errorf("duration %s must be above 0 and at most 24h", value)
+	}
+	return duration, nil
+}
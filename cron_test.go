@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCronMatchesDay(t *testing.T) {
+	tests := []struct {
+		expression string
+		day        string
+		want       bool
+	}{
+		{"0 9 * * MON#1", "2026-01-05", true},
+		{"0 9 * * MON#1", "2026-01-12", false},
+		{"0 9 * * 1#2", "2026-01-12", true},
+		{"0 9 * * 5L", "2026-01-30", true},
+		{"0 9 * * 5L", "2026-01-23", false},
+		{"0 9 * * FRIL", "2026-02-27", true},
+		{"0 9 L * *", "2026-02-28", true},
+		{"0 9 L * *", "2026-02-27", false},
+		{"0 9 L * *", "2028-02-29", true},
+		{"0 9 L * *", "2026-04-30", true},
+		// A day matches either day field when both are restricted
+		{"0 9 1 * MON", "2026-06-08", true},
+		{"0 9 1 * MON", "2026-07-01", true},
+		{"0 9 1 * MON", "2026-07-02", false},
+		{"0 9 1 * *", "2026-07-06", false},
+		{"0 9 * * 7", "2026-01-04", true},
+		{"0 9 * JAN-MAR MON-FRI", "2026-04-01", false},
+		{"@monthly", "2026-05-01", true},
+		{"@monthly", "2026-05-02", false},
+	}
+	for _, test := range tests {
+		cron, err := parseCron(test.expression)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", test.expression, err)
+		}
+		day, _ := time.Parse("2006-01-02", test.day)
+		if got := cron.matchesDay(day); got != test.want {
+			t.Errorf("%q on %s: got %t, want %t", test.expression, test.day, got, test.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{"0 9 * *", "60 * * * *", "0 24 * * *", "0 9 * * MON#6", "0 9 * * MON#0", "0 9 5-1 * *", "*/0 * * * *", "0 9 * FOO *"} {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expression)
+		}
+	}
+}
+
+func TestCronStartsOn(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	tests := []struct {
+		expression string
+		day        time.Time
+		want       []string
+	}{
+		{"0,30 9 * * *", time.Date(2026, 3, 2, 0, 0, 0, 0, berlin), []string{"09:00 +0100", "09:30 +0100"}},
+		// Times skipped when the clocks go forward all start at 03:00
+		{"*/30 2 * * *", time.Date(2026, 3, 29, 0, 0, 0, 0, berlin), []string{"03:00 +0200"}},
+		{"0 9 * * SAT", time.Date(2026, 3, 2, 0, 0, 0, 0, berlin), nil},
+	}
+	for _, test := range tests {
+		cron, err := parseCron(test.expression)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", test.expression, err)
+		}
+		var got []string
+		for _, start := range cron.startsOn(test.day) {
+			got = append(got, start.Format("15:04 -0700"))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q on %s: got %v, want %v", test.expression, test.day.Format("2006-01-02"), got, test.want)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -32,6 +35,11 @@ func readBlockedYamlFile(filename string) (HeaderSite, error) {
 // Function to write to yaml file
 func writeToYamlFile(filename string, name string, url string, expiryTimeString string) error {
 	// Read yaml file
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	headerSites, err := readBlockedYamlFile(filename)
 	formatted_url := FormatString(url)
 	if err != nil {
@@ -56,12 +64,18 @@ func writeToYamlFile(filename string, name string, url string, expiryTimeString
 
 	// Write to original file
 	writeAndSave(filename, headerSites)
+	auditLog(auditAddSite, formatted_url, nil, newSite, "")
 
 	return nil
 }
 
 // Function to edit blocked status on yaml file
 func editblockedStatusOnYamlFile(filename string, url string, status bool) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	headerSites, err := readBlockedYamlFile(filename)
 	if err != nil {
 		return err
@@ -70,6 +84,10 @@ func editblockedStatusOnYamlFile(filename string, url string, status bool) error
 	for i := range headerSites.Sites {
 		if headerSites.Sites[i].URL == url {
 			headerSites.Sites[i].CurrentlyBlocked = status
+			if !status {
+				headerSites.Sites[i].Locked = false // Locks only last for the block they were set on
+				headerSites.Sites[i].PendingUnblock = ""
+			}
 			validURL = true
 			break
 		}
@@ -85,7 +103,12 @@ func editblockedStatusOnYamlFile(filename string, url string, status bool) error
 
 // Function to update the expiry time for blocked sites
 func updateExpiryTime(filename string, url string, newExpiryTime time.Time, alreadyExists bool) error {
-	newExpiryTimeStr := newExpiryTime.Format(DateTimeLayout)
+	newExpiryTimeStr := formatStoredTime(newExpiryTime)
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	sites, err := readBlockedYamlFile(filename)
 	if err != nil {
 		return err
@@ -97,8 +120,19 @@ func updateExpiryTime(filename string, url string, newExpiryTime time.Time, alre
 
 	// Iterating through sites to find if requested site is blocked
 	siteExists := false
+	previousExpiry := ""
 	for i := range sites.Sites {
 		if sites.Sites[i].URL == url {
+			currentExpiry, err := time.Parse(DateTimeLayout, sites.Sites[i].Duration)
+			if isSiteLockActive(sites.Sites[i]) && err == nil && newExpiryTime.Before(currentExpiry) {
+				return fmt.Errorf("%w: %s cannot be shortened before %s", errBlockLocked, url, displayStoredTime(sites.Sites[i].Duration))
+			}
+			// Shortening a block to end within the cooldown would skip it, the unblock has to be requested instead
+			cooldown := settingsDuration(getSettings().UnblockCooldown)
+			if sites.Sites[i].CurrentlyBlocked && cooldown > 0 && err == nil && newExpiryTime.Before(currentExpiry) && newExpiryTime.Before(time.Now().Add(cooldown)) {
+				return fmt.Errorf("%s cannot be shortened to end within the unblock cooldown of %s, request an unblock instead", url, cooldown)
+			}
+			previousExpiry = sites.Sites[i].Duration
 			sites.Sites[i].Duration = newExpiryTimeStr
 			siteExists = true
 			break
@@ -112,10 +146,16 @@ func updateExpiryTime(filename string, url string, newExpiryTime time.Time, alre
 
 	// Writing to original file
 	writeAndSave(filename, sites)
+	action := actionExtend
+	if currentExpiry, err := time.Parse(DateTimeLayout, previousExpiry); err == nil && newExpiryTime.Before(currentExpiry) {
+		action = actionShorten
+	}
+	auditLog(action, url, previousExpiry, newExpiryTimeStr, "")
 
 	if alreadyExists { // bool to check if the site already exists in config, if it does, we need to update the goroutine. If it does not ie. startup, skip
 		fmt.Printf("Updated expiry time for site: %s to %v", url, newExpiryTimeStr)
-		cleanup(false, url)
+		// Replace the timer goroutine, the hosts entry stays in place so locked sites are never unblocked
+		removeGouroutine(url)
 		blockSites(false, filename, url, newExpiryTime, false)
 	}
 	return nil
@@ -159,10 +199,73 @@ func updateHostsFile(sites []string) error {
 	return nil
 }
 
+// Function to add the hosts entry of a blocked site again if it is missing.
+// The context of the site goroutine is checked under the hosts lock so a site unblocked by cleanup is never restored
+func restoreHostsEntry(ctx context.Context, url string) (bool, error) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	content, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return false, err
+	}
+	entry := fmt.Sprintf("127.0.0.1 %s", url)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return false, nil
+		}
+	}
+
+	file, err := os.OpenFile(hostsFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if !strings.Contains(string(content), "# Added by selfcontrol") {
+		if _, err := file.WriteString("\n# Added by selfcontrol\n"); err != nil {
+			return false, err
+		}
+	} else if len(content) > 0 && content[len(content)-1] != '\n' {
+		file.WriteString("\n")
+	}
+	if _, err := file.WriteString(entry + "\n"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Function to get why a site is being unblocked, for the audit log and metrics
+func unblockReason(filename string, url string) string {
+	if pendingUnblockDue(url) {
+		return unblockCauseCooldown
+	}
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return unblockCauseManual
+	}
+	for _, site := range headerSites.Sites {
+		if site.URL == url {
+			if expiryTime, err := time.Parse(DateTimeLayout, site.Duration); err == nil && !time.Now().Before(expiryTime) {
+				return unblockCauseExpired
+			}
+			break
+		}
+	}
+	return unblockCauseManual
+}
+
 // Function to delete site from yaml file
 func deleteSiteFromYamlFile(filename string, name, url string) error {
 
 	// Read yaml file
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	headerSites, err := readBlockedYamlFile(filename)
 	if err != nil {
 		return err
@@ -170,6 +273,7 @@ func deleteSiteFromYamlFile(filename string, name, url string) error {
 
 	// Remove site from yaml file
 	var updatedSites []Site
+	var deletedSite Site
 	name = strings.TrimSpace(strings.ToLower(name))
 	exists := false
 	for _, site := range headerSites.Sites {
@@ -178,6 +282,10 @@ func deleteSiteFromYamlFile(filename string, name, url string) error {
 		} else if site.URL != url {
 			updatedSites = append(updatedSites, site)
 		} else {
+			if isSiteLockActive(site) {
+				return fmt.Errorf("%w: %s (until %s)", errBlockLocked, site.URL, displayStoredTime(site.Duration))
+			}
+			deletedSite = site
 			exists = true
 		}
 	}
@@ -189,6 +297,7 @@ func deleteSiteFromYamlFile(filename string, name, url string) error {
 
 	//Write and truncate original file
 	writeAndSave(filename, headerSites)
+	auditLog(actionDeleteSite, url, deletedSite, nil, "")
 
 	return nil
 }
@@ -214,75 +323,120 @@ func readScheduleYamlFile(filename string) (HeaderSchedule, error) {
 
 func createNewSchedule(reader *bufio.Reader) {
 	fmt.Print("Enter name of schedule: ")
-	name := FormatString(readUserInput(reader))
-	fmt.Print("Enter days to block seperated by commas: ")
-	days := FormatString(readUserInput(reader))
-	startTimeFormatted := queryForTime(reader, true)
-	endTimeFormatted := queryForTime(reader, false)
-	if err := checkStartBeforeEnd(startTimeFormatted, endTimeFormatted); err != nil {
-		fmt.Println("Error in time inputs: ", err)
-		return
-	}
-	cleanedDays, err := formatDaysSlice(days)
+	schedule := Schedule{Name: FormatString(readUserInput(reader))}
+	fmt.Print("Enter a cron expression for the start of each window (e.g. 0 9 * * MON#1), or leave empty to enter days and times: ")
+	schedule.Cron = readUserInput(reader)
+	if schedule.Cron != "" {
+		fmt.Print("Enter how long each window lasts (e.g. 2h): ")
+		schedule.Duration = readUserInput(reader)
+	} else {
+		fmt.Print("Enter days to block seperated by commas: ")
+		schedule.Days = []string{FormatString(readUserInput(reader))}
+		schedule.StartTime = queryForTime(reader, true)
+		schedule.EndTime = queryForTime(reader, false)
+	}
+	fmt.Print("Enter mode (block/allowlist, default block): ")
+	schedule.Mode = readUserInput(reader)
+	schedule.Locked = queryForLock(reader)
+	fmt.Print("Enter the days the schedule is in force, comma separated (e.g. 2026-11-01..2026-12-15), empty for always: ")
+	schedule.Valid = []string{readUserInput(reader)}
+	fmt.Print("Enter the time zone of the schedule (e.g. Europe/Berlin), empty for local time: ")
+	schedule.TimeZone = readUserInput(reader)
+
+	schedule, err := normalizeSchedule(schedule)
 	if err != nil {
-		fmt.Println("Error formatting days: ", err)
+		fmt.Println("Error in schedule inputs: ", err)
 		return
 	}
-	newSchedule, err := writeToScheduleYamlFile(schedulesFilePath, name, cleanedDays, startTimeFormatted, endTimeFormatted)
+	newSchedule, err := writeToScheduleYamlFile(schedulesFilePath, schedule)
 	if err != nil {
 		fmt.Println("Error writing to schedule yaml file: ", err)
 		return
 	}
-	fmt.Printf("Schedule %s created successfully\n", name)
+	fmt.Printf("Schedule %s created successfully\n", newSchedule.Name)
 	printScheduleInfo(newSchedule)
 }
 
 // Function to create a new schedule and write in to yaml file
-func writeToScheduleYamlFile(filename string, name string, days []string, startTime string, endTime string) (Schedule, error) {
+func writeToScheduleYamlFile(filename string, newSchedule Schedule) (Schedule, error) {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return Schedule{}, err
+	}
+	defer unlock()
 	headerSchedule, err := readScheduleYamlFile(filename)
 	if err != nil {
 		return Schedule{}, err
 	}
 
 	for _, schedule := range headerSchedule.Schedules {
-		if schedule.Name == name {
+		if schedule.Name == newSchedule.Name {
 			return schedule, fmt.Errorf("Schedule already exists")
 		}
 	}
 
-	newSchedule := Schedule{
-		Name:      name,
-		Days:      days,
-		StartTime: startTime,
-		EndTime:   endTime,
-	}
 	headerSchedule.Schedules = append(headerSchedule.Schedules, newSchedule)
 
 	writeAndSave(filename, headerSchedule)
+	auditLog(auditAddSchedule, newSchedule.Name, nil, newSchedule, "")
 	return newSchedule, nil
 }
 
-// Function to edit schedules on yaml file
+// Function to edit schedules on yaml file.
+// Schedules cannot be changed at all while their lock is active
 func editSchedulesonYamlFile(filename string, reader *bufio.Reader) error {
 	fmt.Print("Enter name of schedule to edit: ")
 	name := readUserInput(reader)
-	fmt.Print("Enter option to edit(1: Edit name 2: Edit days 3: Edit start time 4: Edit end time): ")
+	fmt.Print("Enter option to edit(1: Edit name 2: Edit days 3: Edit start time 4: Edit end time 5: Edit mode 6: Edit lock 7: Edit exceptions 8: Edit cron 9: Edit validity 10: Edit time zone): ")
 	option := readUserInput(reader)
-	var field string
+	var field, duration string
 	if option == "3" || option == "4" {
 		field = queryForTime(reader, option == "3")
+	} else if option == "6" {
+		fmt.Print("Lock blocks started by this schedule until the window ends? (y/n): ")
+		field = FormatString(readUserInput(reader))
+	} else if option == "7" {
+		fmt.Print("Enter days and ranges the schedule does not run, comma separated (e.g. 2026-12-24, 2026-12-27..2027-01-02), empty for none: ")
+		field = readUserInput(reader)
+	} else if option == "8" {
+		fmt.Print("Enter a cron expression for the start of each window (e.g. 0 9 * * MON#1), empty to go back to days and times: ")
+		field = readUserInput(reader)
+		if field != "" {
+			fmt.Print("Enter how long each window lasts (e.g. 2h): ")
+			duration = readUserInput(reader)
+		}
+	} else if option == "9" {
+		fmt.Print("Enter the days the schedule is in force, comma separated (e.g. 2026-11-01..2026-12-15), empty for always: ")
+		field = readUserInput(reader)
+	} else if option == "10" {
+		fmt.Print("Enter the time zone of the schedule (e.g. Europe/Berlin), empty for local time: ")
+		field = readUserInput(reader)
 	} else {
 		fmt.Print("Enter field to edit: ")
 		field = readUserInput(reader)
 	}
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	headerSchedule, err := readScheduleYamlFile(filename)
 	if err != nil {
 		return err
 	}
+	for _, schedule := range headerSchedule.Schedules {
+		if schedule.Name == name && isScheduleLockActive(schedule, time.Now()) {
+			return fmt.Errorf("%w: schedule %s cannot be changed during its window", errBlockLocked, name)
+		}
+	}
 
 	validSchedule := false
+	var before, after Schedule
 outer:
 	for i := range headerSchedule.Schedules {
+		if headerSchedule.Schedules[i].Name == name {
+			before = headerSchedule.Schedules[i]
+		}
 		switch option {
 		case "1":
 			if headerSchedule.Schedules[i].Name == name {
@@ -323,11 +477,95 @@ outer:
 				headerSchedule.Schedules[i].EndTime = field
 				validSchedule = true
 			}
+		case "5":
+			if headerSchedule.Schedules[i].Name == name {
+				mode, err := formatScheduleMode(field)
+				if err != nil {
+					fmt.Println("Error formatting mode: ", err)
+					break outer
+				}
+				fmt.Printf("Changed mode from %s to %s\n", scheduleMode(headerSchedule.Schedules[i]), mode)
+				headerSchedule.Schedules[i].Mode = mode
+				validSchedule = true
+				break outer
+			}
+		case "6":
+			if headerSchedule.Schedules[i].Name == name {
+				locked := field == "y"
+				fmt.Printf("Changed lock from %t to %t\n", headerSchedule.Schedules[i].Locked, locked)
+				headerSchedule.Schedules[i].Locked = locked
+				validSchedule = true
+				break outer
+			}
+		case "7":
+			if headerSchedule.Schedules[i].Name == name {
+				exceptions, err := formatDateRanges(field)
+				if err != nil {
+					fmt.Println("Error formatting exceptions: ", err)
+					break outer
+				}
+				fmt.Printf("Changed exceptions from %s to %s\n", strings.Join(headerSchedule.Schedules[i].Exceptions, ", "), strings.Join(exceptions, ", "))
+				headerSchedule.Schedules[i].Exceptions = exceptions
+				validSchedule = true
+				break outer
+			}
+		case "8":
+			if headerSchedule.Schedules[i].Name == name {
+				if field == "" {
+					if len(headerSchedule.Schedules[i].Days) == 0 {
+						fmt.Println("Error removing cron expression: the schedule has no days and times to fall back to, create a new schedule instead")
+						break outer
+					}
+					fmt.Printf("Removed cron expression %s, the schedule runs on its days and times\n", headerSchedule.Schedules[i].Cron)
+					headerSchedule.Schedules[i].Cron, headerSchedule.Schedules[i].Duration = "", ""
+					validSchedule = true
+					break outer
+				}
+				cron, cronDuration, err := formatCron(field, duration)
+				if err != nil {
+					fmt.Println("Error formatting cron expression: ", err)
+					break outer
+				}
+				fmt.Printf("Changed cron from %q to %q lasting %s\n", headerSchedule.Schedules[i].Cron, cron, cronDuration)
+				headerSchedule.Schedules[i].Cron, headerSchedule.Schedules[i].Duration = cron, cronDuration
+				validSchedule = true
+				break outer
+			}
+		case "9":
+			if headerSchedule.Schedules[i].Name == name {
+				valid, err := formatDateRanges(field)
+				if err != nil {
+					fmt.Println("Error formatting validity: ", err)
+					break outer
+				}
+				fmt.Printf("Changed validity from %s to %s\n", strings.Join(headerSchedule.Schedules[i].Valid, ", "), strings.Join(valid, ", "))
+				headerSchedule.Schedules[i].Valid = valid
+				validSchedule = true
+				break outer
+			}
+		case "10":
+			if headerSchedule.Schedules[i].Name == name {
+				timeZone, err := formatTimeZone(field)
+				if err != nil {
+					fmt.Println("Error formatting time zone: ", err)
+					break outer
+				}
+				fmt.Printf("Changed time zone from %q to %q\n", headerSchedule.Schedules[i].TimeZone, timeZone)
+				headerSchedule.Schedules[i].TimeZone = timeZone
+				validSchedule = true
+				break outer
+			}
 		}
 
 	}
 	if validSchedule {
+		for _, schedule := range headerSchedule.Schedules {
+			if schedule.Name == name || (option == "1" && schedule.Name == field) {
+				after = schedule
+			}
+		}
 		writeAndSave(filename, headerSchedule)
+		auditLog(actionEditSchedule, name, before, after, "")
 		fmt.Println("Schedule edited successfully")
 	} else {
 		return fmt.Errorf("Schedule %s not found", name)
@@ -335,25 +573,109 @@ outer:
 	return nil
 }
 
+// Function to replace a schedule with an edited copy given in full, the name can change.
+// Schedules cannot be changed at all while their lock is active
+func replaceScheduleOnYamlFile(filename string, name string, updated Schedule) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	headerSchedule, err := readScheduleYamlFile(filename)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, schedule := range headerSchedule.Schedules {
+		if schedule.Name == name {
+			index = i
+		} else if schedule.Name == updated.Name {
+			return fmt.Errorf("Schedule %s already exists", updated.Name)
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("Schedule %s not found", name)
+	}
+	before := headerSchedule.Schedules[index]
+	if isScheduleLockActive(before, time.Now()) {
+		return fmt.Errorf("%w: schedule %s cannot be changed during its window", errBlockLocked, name)
+	}
+
+	headerSchedule.Schedules[index] = updated
+	if err := writeAndSave(filename, headerSchedule); err != nil {
+		return err
+	}
+	auditLog(actionEditSchedule, name, before, updated, "")
+	return nil
+}
+
+// Function to skip a schedule for the rest of the day. The skip takes effect once the unblock cooldown has
+// passed and cannot be used during the window of a locked schedule. Blocks the schedule already started stay until they expire
+func skipScheduleToday(filename string, name string, currentTime time.Time) (time.Time, error) {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer unlock()
+	headerSchedule, err := readScheduleYamlFile(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	index := slices.IndexFunc(headerSchedule.Schedules, func(schedule Schedule) bool { return schedule.Name == name })
+	if index < 0 {
+		return time.Time{}, fmt.Errorf("Schedule %s not found", name)
+	}
+	before := headerSchedule.Schedules[index]
+	if isScheduleLockActive(before, currentTime) {
+		return time.Time{}, fmt.Errorf("%w: schedule %s cannot be skipped during its window", errBlockLocked, name)
+	}
+	// Today is the day in the schedule's time zone
+	location := scheduleLocation(before)
+	skipFrom := currentTime.Add(max(settingsDuration(getSettings().UnblockCooldown), 0))
+	if skipFrom.In(location).Format(dateLayout) != currentTime.In(location).Format(dateLayout) {
+		return time.Time{}, fmt.Errorf("the unblock cooldown runs past the end of today, nothing would be skipped")
+	}
+
+	headerSchedule.Schedules[index].SkipDate = currentTime.In(location).Format(dateLayout)
+	headerSchedule.Schedules[index].SkipFrom = formatStoredTime(skipFrom)
+	if err := writeAndSave(filename, headerSchedule); err != nil {
+		return time.Time{}, err
+	}
+	auditLog(actionSkipSchedule, name, before, headerSchedule.Schedules[index], "")
+	return skipFrom, nil
+}
+
 // Function to delete schedule from yaml file
 func deleteScheduleFromYamlFile(filename string, name string) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	headerSchedule, err := readScheduleYamlFile(filename)
 	if err != nil {
 		return err
 	}
 
 	validSchedule := false
+	var deletedSchedule Schedule
 	var updatedSchedules []Schedule
 	for _, schedule := range headerSchedule.Schedules {
 		if schedule.Name != name {
 			updatedSchedules = append(updatedSchedules, schedule)
 		} else {
+			if isScheduleLockActive(schedule, time.Now()) {
+				return fmt.Errorf("%w: schedule %s is locked until its window ends", errBlockLocked, name)
+			}
+			deletedSchedule = schedule
 			validSchedule = true
 		}
 	}
 	if validSchedule {
 		headerSchedule.Schedules = updatedSchedules
 		writeAndSave(filename, headerSchedule)
+		auditLog(actionDeleteSchedule, name, deletedSchedule, nil, "")
 		fmt.Printf("Schedule %s deleted successfully", name)
 		return nil
 	} else {
@@ -361,7 +683,145 @@ func deleteScheduleFromYamlFile(filename string, name string) error {
 	}
 }
 
+// Functions for allowlist.yaml
+
+// Function to read allowlist yaml file, returns a HeaderAllowlist struct
+func readAllowlistYamlFile(filename string) (HeaderAllowlist, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return HeaderAllowlist{}, err
+	}
+	defer file.Close()
+
+	var headerAllowlist HeaderAllowlist
+	decoder := yaml.NewDecoder(file)
+	err = decoder.Decode(&headerAllowlist)
+	if err != nil {
+		return HeaderAllowlist{}, err
+	}
+	return headerAllowlist, nil
+}
+
+// Function to set whether allowlist mode is active on yaml file
+func setAllowlistActive(filename string, active bool) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	allowlist.Active = active
+	if !active {
+		allowlist.Locked = false
+		allowlist.PendingUnblock = ""
+	}
+	return writeAndSave(filename, allowlist)
+}
+
+// Function to add a domain to the allowlist yaml file
+func addAllowedDomain(filename string, domain string) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, allowed := range allowlist.Domains {
+		if allowed == domain {
+			return fmt.Errorf("Domain already allowed")
+		}
+	}
+	allowlist.Domains = append(allowlist.Domains, domain)
+	if err := writeAndSave(filename, allowlist); err != nil {
+		return err
+	}
+	auditLog(actionAllowDomain, domain, nil, nil, "")
+	return nil
+}
+
+// Function to remove a domain from the allowlist yaml file
+func removeAllowedDomain(filename string, domain string) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	allowlist, err := readAllowlistYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	var updatedDomains []string
+	for _, allowed := range allowlist.Domains {
+		if allowed != domain {
+			updatedDomains = append(updatedDomains, allowed)
+		}
+	}
+	if len(updatedDomains) == len(allowlist.Domains) {
+		return fmt.Errorf("Domain not found in allowlist")
+	}
+	allowlist.Domains = updatedDomains
+	if err := writeAndSave(filename, allowlist); err != nil {
+		return err
+	}
+	auditLog(auditDisallowDomain, domain, nil, nil, "")
+	return nil
+}
+
+// Functions for settings.yaml
+
+// Function to read settings yaml file, returns a Settings struct
+func readSettingsYamlFile(filename string) (Settings, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Settings{}, err
+	}
+	defer file.Close()
+
+	var settings Settings
+	decoder := yaml.NewDecoder(file)
+	err = decoder.Decode(&settings)
+	if err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// Function to get the current settings, falling back to the defaults if the file cannot be read
+func getSettings() Settings {
+	settings, err := readSettingsYamlFile(settingsFilePath)
+	if err != nil {
+		settings, err = readSettingsYamlFile(absolutePathToSelfControl + "/" + settingsFilePath)
+		if err != nil {
+			return Settings{}
+		}
+	}
+	return settings
+}
+
 // Function to write to yaml file
+// Function to lock a config file for a read-modify-write, so the menu, the API and commands run from other
+// processes don't overwrite each other's changes. The lock is released by calling the returned function
+func lockConfigFile(filename string) (func(), error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error locking %s: %v", filename, err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
 func writeAndSave(filename string, data interface{}) error {
 	// Write to original file
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_TRUNC, 0644)
@@ -415,8 +875,10 @@ func addBackgroundBlocks() {
 				continue
 			}
 			if time.Now().Before(expiryTime) {
+				restorePendingUnblock(site.URL, site.PendingUnblock)
 				blockSites(false, absolutePathToSelfControl+"/configs/blocked-sites.yaml", site.URL, expiryTime, false)
 			}
 		}
 	}
+	resumeAllowlistMode(absolutePathToSelfControl+"/"+allowlistFilePath, false)
 }
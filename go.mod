@@ -6,7 +6,11 @@ require gopkg.in/yaml.v3 v3.0.1
 
 require (
 	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
 	golang.org/x/term v0.27.0
 )
 
-require golang.org/x/sys v0.28.0 // indirect
+require (
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Addresses used by hosts-style blocklists that should never be imported as sites
+var ignoredHostsEntries = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"0.0.0.0":               true,
+}
+
+// Function to read a blocklist file and return the de-duplicated domains in it
+func parseBlocklistFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		for _, domain := range parseBlocklistLine(scanner.Text()) {
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// Function to extract domains from a single blocklist line.
+// Supports hosts-style ("0.0.0.0 domain"), AdBlock ("||domain^") and one-domain-per-line formats
+func parseBlocklistLine(line string) []string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return nil
+	}
+
+	// AdBlock format, exception rules (@@) are not blocks so they are skipped
+	if strings.HasPrefix(line, "@@") {
+		return nil
+	}
+	if strings.HasPrefix(line, "||") {
+		domain := strings.TrimPrefix(line, "||")
+		if i := strings.IndexAny(domain, "^$/"); i >= 0 {
+			domain = domain[:i]
+		}
+		return validBlocklistDomains(domain)
+	}
+
+	// Strip trailing comments
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Hosts format, the first field is an address followed by one or more domains
+	if isHostsAddress(fields[0]) {
+		return validBlocklistDomains(fields[1:]...)
+	}
+	return validBlocklistDomains(fields[0])
+}
+
+// Function to check if a field is an address used in hosts-style blocklists
+func isHostsAddress(field string) bool {
+	switch field {
+	case "0.0.0.0", "127.0.0.1", "::", "::1", "0":
+		return true
+	}
+	return false
+}
+
+// Function to normalise candidate entries, dropping any that cannot be used as hosts file entries
+func validBlocklistDomains(candidates ...string) []string {
+	var domains []string
+	for _, candidate := range candidates {
+		if ignoredHostsEntries[strings.ToLower(candidate)] || strings.Contains(candidate, "*") {
+			continue
+		}
+		domain, err := NormalizeDomain(candidate)
+		if err != nil {
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// Function to import a blocklist file into the blocked sites yaml file under a named group
+func importBlocklist(filename string, sourcePath string, groupName string) (int, int, error) {
+	groupName = FormatString(groupName)
+	if groupName == "" {
+		return 0, 0, fmt.Errorf("group name cannot be empty")
+	}
+	absoluteSource, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	domains, err := parseBlocklistFile(absoluteSource)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading blocklist: %w", err)
+	}
+
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Remember where the group came from so it can be re-synced later
+	groupExists := false
+	for i := range headerSites.Groups {
+		if headerSites.Groups[i].Name == groupName {
+			headerSites.Groups[i].Source = absoluteSource
+			groupExists = true
+			break
+		}
+	}
+	if !groupExists {
+		headerSites.Groups = append(headerSites.Groups, Group{Name: groupName, Source: absoluteSource})
+	}
+
+	added, skipped := addSitesToGroup(&headerSites, domains, groupName)
+	if err := writeAndSave(filename, headerSites); err != nil {
+		return 0, 0, err
+	}
+	auditLog(auditImportBlocklist, groupName, nil, nil, fmt.Sprintf("%d added, %d skipped from %s", added, skipped, absoluteSource))
+	return added, skipped, nil
+}
+
+// Function to re-sync a group from the file it was imported from, adding new and removing dropped entries.
+// Dropped entries that cannot be unblocked, such as locked ones, stay in the config and are counted as skipped
+func resyncBlocklistGroup(filename string, groupName string) (int, int, int, error) {
+	groupName = FormatString(groupName)
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var source string
+	for _, group := range headerSites.Groups {
+		if group.Name == groupName {
+			source = group.Source
+			break
+		}
+	}
+	if source == "" {
+		return 0, 0, 0, fmt.Errorf("group %s was not imported from a file", groupName)
+	}
+
+	domains, err := parseBlocklistFile(source)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("error reading blocklist: %w", err)
+	}
+	wanted := make(map[string]bool)
+	for _, domain := range domains {
+		wanted[domain] = true
+	}
+
+	// Unblock entries that are no longer in the source file before dropping them from the config
+	removed := make(map[string]bool)
+	skipped := 0
+	for _, site := range headerSites.Sites {
+		if site.Group != groupName || wanted[site.URL] {
+			continue
+		}
+		if site.CurrentlyBlocked {
+			pendingUntil, err := unblockBeforeRemoval(filename, site.URL)
+			if err != nil {
+				// Dropping the site anyway would leave its hosts entry with nothing to lift it
+				if errors.Is(err, errBlockLocked) {
+					fmt.Printf("Skipped %s: %v\n", site.URL, err)
+				} else {
+					fmt.Printf("Skipped %s, error unblocking it: %v\n", site.URL, err)
+				}
+				skipped++
+				continue
+			}
+			if !pendingUntil.IsZero() {
+				fmt.Printf("Skipped %s, unblock requested, it is dropped by the next resync after %s\n", site.URL, formatLocalTime(pendingUntil))
+				skipped++
+				continue
+			}
+		}
+		removed[site.URL] = true
+	}
+
+	// Unblocking or requesting an unblock rewrites the yaml file, so re-read before applying the changes
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer unlock()
+	headerSites, err = readBlockedYamlFile(filename)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var keptSites []Site
+	for _, site := range headerSites.Sites {
+		if site.Group == groupName && removed[site.URL] {
+			continue
+		}
+		keptSites = append(keptSites, site)
+	}
+	headerSites.Sites = keptSites
+
+	added, _ := addSitesToGroup(&headerSites, domains, groupName)
+	if err := writeAndSave(filename, headerSites); err != nil {
+		return 0, 0, 0, err
+	}
+	auditLog(actionResyncGroup, groupName, nil, nil, fmt.Sprintf("%d added, %d removed, %d skipped", added, len(removed), skipped))
+	return added, len(removed), skipped, nil
+}
+
+// Function to append domains that are not already configured as sites in the given group
+func addSitesToGroup(headerSites *HeaderSite, domains []string, groupName string) (int, int) {
+	existing := make(map[string]bool)
+	for _, site := range headerSites.Sites {
+		existing[site.URL] = true
+	}
+
+	added, skipped := 0, 0
+	now := formatStoredTime(time.Now())
+	for _, domain := range domains {
+		if existing[domain] {
+			skipped++
+			continue
+		}
+		existing[domain] = true
+		headerSites.Sites = append(headerSites.Sites, Site{
+			Name:             GetNameFromURL(domain),
+			URL:              domain,
+			Duration:         now,
+			CurrentlyBlocked: false,
+			Group:            groupName,
+		})
+		added++
+	}
+	return added, skipped
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Returned when an action would remove or shorten a locked block before it expires
+var errBlockLocked = errors.New("block is locked until it expires")
+
+// Function to check if a site is blocked with a lock that has not expired yet
+func isSiteLockActive(site Site) bool {
+	if !site.Locked || !site.CurrentlyBlocked {
+		return false
+	}
+	expiryTime, err := time.Parse(DateTimeLayout, site.Duration)
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(expiryTime)
+}
+
+// Function to check if allowlist mode is active with a lock that has not expired yet
+func isAllowlistLockActive(allowlist HeaderAllowlist) bool {
+	if !allowlist.Locked || !allowlist.Active {
+		return false
+	}
+	expiryTime, err := time.Parse(DateTimeLayout, allowlist.Expiry)
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(expiryTime)
+}
+
+// Function to check if a locked schedule is inside one of its blocking windows
+func isScheduleLockActive(schedule Schedule, currentTime time.Time) bool {
+	return schedule.Locked && isScheduleWindowActive(schedule, currentTime)
+}
+
+// Function to check if the current time falls inside a schedule's blocking window
+func isScheduleWindowActive(schedule Schedule, currentTime time.Time) bool {
+	return len(scheduleWindows(schedule, currentTime, currentTime.Add(time.Second))) > 0
+}
+
+// Function to check that none of the given sites have an active lock.
+// When all is false only the site matching url is checked
+func checkSitesUnlocked(filename string, all bool, url string) error {
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	var locked []string
+	for _, site := range headerSites.Sites {
+		if (all || site.URL == url) && isSiteLockActive(site) {
+			locked = append(locked, fmt.Sprintf("%s (until %s)", site.URL, displayStoredTime(site.Duration)))
+		}
+	}
+	if len(locked) > 0 {
+		return fmt.Errorf("%w: %s", errBlockLocked, strings.Join(locked, ", "))
+	}
+	return nil
+}
+
+// Function to lock a blocked site until its current expiry time
+func lockSite(filename string, url string) error {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return err
+	}
+	for i := range headerSites.Sites {
+		if headerSites.Sites[i].URL == url {
+			if !headerSites.Sites[i].CurrentlyBlocked {
+				return fmt.Errorf("%s is not currently blocked", url)
+			}
+			// A locked block cannot be lifted early, so drop any pending unblock
+			headerSites.Sites[i].Locked = true
+			headerSites.Sites[i].PendingUnblock = ""
+			clearPendingUnblock(url)
+			if err := writeAndSave(filename, headerSites); err != nil {
+				return err
+			}
+			auditLog(auditLockSite, url, nil, headerSites.Sites[i].Duration, "")
+			return nil
+		}
+	}
+	return fmt.Errorf("URL not found in config file")
+}
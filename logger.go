@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// How the process was started, decides where log records go
+const (
+	logTargetFile    = "file"    // Interactive and background runs write to a rotating log file
+	logTargetJournal = "journal" // systemd startup runs write to stderr with journald priority prefixes
+)
+
+// Logger used by the blocking code, replaced by setupLogging once settings are known.
+// Logs are discarded until then so the interactive menu is never cluttered with them
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// Function to parse the log level from settings, defaults to info
+func parseLogLevel(level string) slog.Level {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return parsed
+}
+
+// Function to set up the logger for how the process was started
+func setupLogging(target string) {
+	settings := getSettings()
+	options := &slog.HandlerOptions{Level: parseLogLevel(settings.LogLevel)}
+	if target == logTargetJournal {
+		logger = slog.New(newJournalHandler(os.Stderr, options))
+		return
+	}
+
+	maxSize := int64(settings.LogMaxSizeMB) * 1024 * 1024
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSize
+	}
+	maxFiles := settings.LogMaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultLogMaxFiles
+	}
+	logger = slog.New(slog.NewJSONHandler(&rotatingFile{path: logFilePath, maxSize: maxSize, maxFiles: maxFiles}, options))
+}
+
+// rotatingFile is an io.Writer appending to a log file that is rotated to .1, .2, ... once it grows past maxSize
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int // Rotated files kept besides the current one
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, err := os.Stat(r.path); err == nil && info.Size()+int64(len(p)) > r.maxSize {
+		r.rotate()
+	}
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return file.Write(p)
+}
+
+// Function to shift the rotated files up by one, dropping the oldest
+func (r *rotatingFile) rotate() {
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	os.Rename(r.path, r.path+".1")
+}
+
+// journalHandler writes the message and attributes of a record prefixed with its syslog priority,
+// e.g. <3> for errors, which journald turns into the priority of the entry. The time is left out as journald adds it
+type journalHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	buffer *bytes.Buffer
+	inner  slog.Handler
+}
+
+func newJournalHandler(out io.Writer, options *slog.HandlerOptions) *journalHandler {
+	buffer := &bytes.Buffer{}
+	textOptions := *options
+	textOptions.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+		if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey || attr.Key == slog.MessageKey) {
+			return slog.Attr{}
+		}
+		return attr
+	}
+	return &journalHandler{mu: &sync.Mutex{}, out: out, buffer: buffer, inner: slog.NewTextHandler(buffer, &textOptions)}
+}
+
+func (h *journalHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *journalHandler) Handle(ctx context.Context, record slog.Record) error {
+	priority := 6 // info
+	switch {
+	case record.Level >= slog.LevelError:
+		priority = 3
+	case record.Level >= slog.LevelWarn:
+		priority = 4
+	case record.Level < slog.LevelInfo:
+		priority = 7
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buffer.Reset()
+	if err := h.inner.Handle(ctx, record); err != nil {
+		return err
+	}
+	line := strings.TrimSpace(record.Message + " " + strings.TrimSpace(h.buffer.String()))
+	_, err := fmt.Fprintf(h.out, "<%d>%s\n", priority, line)
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &journalHandler{mu: h.mu, out: h.out, buffer: h.buffer, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	return &journalHandler{mu: h.mu, out: h.out, buffer: h.buffer, inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Counters of the running process. They start at zero on every launch, which Prometheus treats as a counter reset
+var (
+	metricBlocksApplied    atomic.Int64
+	metricTamperReapplied  atomic.Int64
+	metricHostsWriteErrors atomic.Int64
+)
+
+// Unblock causes that are always reported, even before the first unblock
+var unblockCauses = []string{unblockCauseExpired, unblockCauseCooldown, unblockCauseManual, unblockCauseAll}
+
+// PersistedCounters are counted by whichever process the event happens in, the menu, a command or the
+// background process, so they are kept in a file that the process serving /metrics reads
+type PersistedCounters struct {
+	FailedAttempts int64            `yaml:"failedAttempts"`
+	Unblocks       map[string]int64 `yaml:"unblocks"`
+}
+
+// Config files the gauges and the API read from, these differ between systemd startup and other runs
+type configPaths struct {
+	sitesFile     string
+	schedulesFile string
+	allowlistFile string
+}
+
+// Function to get the persisted counters file, falling back to the absolute path when started by systemd outside the application directory
+func getMetricsFilePath() string {
+	if _, err := os.Stat(filepath.Dir(metricsFilePath)); err != nil {
+		return absolutePathToSelfControl + "/" + metricsFilePath
+	}
+	return metricsFilePath
+}
+
+// Function to read the persisted counters, a missing file means nothing was counted yet
+func readPersistedCounters() (PersistedCounters, error) {
+	var counters PersistedCounters
+	data, err := os.ReadFile(getMetricsFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return counters, nil
+	}
+	if err != nil {
+		return counters, err
+	}
+	err = yaml.Unmarshal(data, &counters)
+	return counters, err
+}
+
+// Function to update the persisted counters. The file is locked so counts from several processes are not lost
+func updatePersistedCounters(update func(*PersistedCounters)) {
+	file, err := os.OpenFile(getMetricsFilePath(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		logger.Error("Error opening metrics file", "error", err)
+		return
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		logger.Error("Error locking metrics file", "error", err)
+		return
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	var counters PersistedCounters
+	data, err := io.ReadAll(file)
+	if err == nil {
+		err = yaml.Unmarshal(data, &counters)
+	}
+	if err != nil {
+		logger.Error("Error reading metrics file", "error", err)
+		return
+	}
+	update(&counters)
+	if data, err = yaml.Marshal(counters); err == nil {
+		if err = file.Truncate(0); err == nil {
+			_, err = file.WriteAt(data, 0)
+		}
+	}
+	if err != nil {
+		logger.Error("Error saving metrics file", "error", err)
+	}
+}
+
+// Function to count an unblock by its cause
+func countUnblock(cause string) {
+	updatePersistedCounters(func(counters *PersistedCounters) {
+		if counters.Unblocks == nil {
+			counters.Unblocks = make(map[string]int64)
+		}
+		counters.Unblocks[cause]++
+	})
+}
+
+// Function to count a rejected password, admin secret or code
+func countFailedAttempt() {
+	updatePersistedCounters(func(counters *PersistedCounters) { counters.FailedAttempts++ })
+}
+
+// Function to start the /metrics endpoint if metricsAddr is set in settings
+func startMetricsServer(sources configPaths) {
+	addr := getSettings().MetricsAddr
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, sources, time.Now())
+	})
+	serveLocal("metrics", addr, true, mux)
+}
+
+// Function to escape a label value for the Prometheus text format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Function to write a metric with its help and type lines
+func writeMetric(w io.Writer, name string, metricType string, help string, samples map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	labels := make([]string, 0, len(samples))
+	for label := range samples {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels) // Stable output makes diffs between scrapes readable
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s%s %s\n", name, label, strconv.FormatFloat(samples[label], 'f', -1, 64))
+	}
+}
+
+// Function to write all metrics in the Prometheus text exposition format
+func writeMetrics(w io.Writer, sources configPaths, now time.Time) {
+	activeBlocks, nextExpiry := 0, time.Time{}
+	if headerSites, err := readBlockedYamlFile(sources.sitesFile); err == nil {
+		for _, site := range headerSites.Sites {
+			expiryTime, err := time.Parse(DateTimeLayout, site.Duration)
+			if !site.CurrentlyBlocked || err != nil || !now.Before(expiryTime) {
+				continue
+			}
+			activeBlocks++
+			if nextExpiry.IsZero() || expiryTime.Before(nextExpiry) {
+				nextExpiry = expiryTime
+			}
+		}
+	}
+	nextExpirySeconds := 0.0
+	if !nextExpiry.IsZero() {
+		nextExpirySeconds = float64(nextExpiry.Unix())
+	}
+	writeMetric(w, "selfcontrol_active_blocks", "gauge", "Sites currently blocked.",
+		map[string]float64{"": float64(activeBlocks)})
+	writeMetric(w, "selfcontrol_next_expiry_timestamp_seconds", "gauge", "Unix time the next block expires, 0 without active blocks.",
+		map[string]float64{"": nextExpirySeconds})
+
+	schedules := map[string]float64{}
+	if headerSchedule, err := readScheduleYamlFile(sources.schedulesFile); err == nil {
+		for _, schedule := range headerSchedule.Schedules {
+			active := 0.0
+			if isScheduleWindowActive(schedule, now) {
+				active = 1
+			}
+			schedules[fmt.Sprintf(`{schedule="%s",mode="%s"}`, escapeLabelValue(schedule.Name), scheduleMode(schedule))] = active
+		}
+		for _, calendar := range headerSchedule.Calendars {
+			active := 0.0
+			if windows, _ := calendarWindows(calendar, now, now.Add(time.Second)); len(windows) > 0 {
+				active = 1
+			}
+			schedules[fmt.Sprintf(`{schedule="%s",mode="%s"}`, escapeLabelValue(calendar.Name), scheduleMode(Schedule{Mode: calendar.Mode}))] = active
+		}
+	}
+	writeMetric(w, "selfcontrol_schedule_active", "gauge", "Whether the window of a schedule is active now.", schedules)
+
+	allowlistActive := 0.0
+	if allowlist, err := readAllowlistYamlFile(sources.allowlistFile); err == nil && allowlist.Active {
+		allowlistActive = 1
+	}
+	writeMetric(w, "selfcontrol_allowlist_active", "gauge", "Whether allowlist focus mode is active.",
+		map[string]float64{"": allowlistActive})
+
+	writeMetric(w, "selfcontrol_blocks_applied_total", "counter", "Site blocks written to the hosts file.",
+		map[string]float64{"": float64(metricBlocksApplied.Load())})
+	counters, err := readPersistedCounters()
+	if err != nil {
+		logger.Error("Error reading metrics file", "error", err)
+	}
+	unblocks := map[string]float64{}
+	for _, cause := range unblockCauses {
+		unblocks[fmt.Sprintf(`{cause="%s"}`, escapeLabelValue(cause))] = 0
+	}
+	for cause, count := range counters.Unblocks {
+		unblocks[fmt.Sprintf(`{cause="%s"}`, escapeLabelValue(cause))] = float64(count)
+	}
+	writeMetric(w, "selfcontrol_unblocks_total", "counter", "Unblocks by cause: expired, cooldown, manual or all.", unblocks)
+	writeMetric(w, "selfcontrol_tamper_reapplied_total", "counter", "Hosts entries removed outside selfcontrol and put back.",
+		map[string]float64{"": float64(metricTamperReapplied.Load())})
+	writeMetric(w, "selfcontrol_failed_password_attempts_total", "counter", "Rejected password, admin secret and two-factor code attempts.",
+		map[string]float64{"": float64(counters.FailedAttempts)})
+	writeMetric(w, "selfcontrol_hosts_write_errors_total", "counter", "Failed reads or writes of the hosts file.",
+		map[string]float64{"": float64(metricHostsWriteErrors.Load())})
+}
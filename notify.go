@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NotificationSettings configures desktop notifications
+type NotificationSettings struct {
+	Disabled  bool     `yaml:"disabled,omitempty"`
+	LeadTimes []string `yaml:"leadTimes,omitempty"` // How long before a schedule window starts to send a notice, at most 24h each. Defaults to 5m
+}
+
+// Notices waiting to be sent, keyed by summary. Sites expiring together are sent as one notice
+var (
+	noticesMu      sync.Mutex
+	pendingNotices = make(map[string][]string)
+)
+
+// Function to report a block lifecycle event to the webhooks and, when a block begins or ends, to the desktop
+func notifyBlockEvent(event string, target string, expiry string, detail string) {
+	notifyWebhooks(event, target, expiry, detail)
+	if getSettings().Notifications.Disabled {
+		return
+	}
+	switch event {
+	case webhookBlockStart:
+		queueNotice("Block started", fmt.Sprintf("%s until %s", target, expiry))
+	case webhookBlockExpire:
+		queueNotice("Block ended", target)
+	case webhookBlockCancel:
+		queueNotice("Block removed early", fmt.Sprintf("%s (%s)", target, detail))
+	}
+}
+
+// Function to queue a line of a notice, the notice is sent once no more lines arrive for a moment
+func queueNotice(summary string, line string) {
+	noticesMu.Lock()
+	defer noticesMu.Unlock()
+	if _, queued := pendingNotices[summary]; !queued {
+		time.AfterFunc(noticeCoalesceDelay, func() {
+			noticesMu.Lock()
+			lines := pendingNotices[summary]
+			delete(pendingNotices, summary)
+			noticesMu.Unlock()
+			if len(lines) > 0 { // Empty when flushNotices sent them already
+				sendDesktopNotification(summary, strings.Join(lines, "\n"))
+			}
+		})
+	}
+	pendingNotices[summary] = append(pendingNotices[summary], line)
+}
+
+// Function to send the queued notices straight away, before the process exits
+func flushNotices() {
+	noticesMu.Lock()
+	notices := pendingNotices
+	pendingNotices = make(map[string][]string)
+	noticesMu.Unlock()
+	for summary, lines := range notices {
+		sendDesktopNotification(summary, strings.Join(lines, "\n"))
+	}
+}
+
+// Function to show a desktop notification, printed to stdout when no notification service can be reached
+func sendDesktopNotification(summary string, body string) {
+	if err := sendDBusNotification(summary, body); err != nil {
+		logger.Debug("Desktop notification failed, printing it instead", "summary", summary, "error", err)
+		fmt.Printf("\n[SelfControl] %s: %s\n", summary, strings.ReplaceAll(body, "\n", ", "))
+		return
+	}
+	logger.Debug("Sent desktop notification", "summary", summary)
+}
+
+// Function to send a freedesktop notification over D-Bus with gdbus, or with notify-send if gdbus is missing
+func sendDBusNotification(summary string, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if path, err := exec.LookPath("gdbus"); err == nil {
+		cmd = exec.CommandContext(ctx, path, "call", "--session",
+			"--dest", "org.freedesktop.Notifications",
+			"--object-path", "/org/freedesktop/Notifications",
+			"--method", "org.freedesktop.Notifications.Notify",
+			strconv.Quote("SelfControl"), "0", strconv.Quote(""), strconv.Quote(summary), strconv.Quote(body), "[]", "{}", "-1")
+	} else if path, err := exec.LookPath("notify-send"); err == nil {
+		cmd = exec.CommandContext(ctx, path, "--app-name=SelfControl", summary, body)
+	} else {
+		return errors.New("neither gdbus nor notify-send is installed")
+	}
+	runInDesktopSession(cmd)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Function to run a command as the user behind sudo on their session bus, root has no desktop session of its own
+func runInDesktopSession(cmd *exec.Cmd) {
+	uid, uidErr := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, gidErr := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if os.Getuid() != 0 || uidErr != nil || gidErr != nil {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/%d/bus", uid))
+}
+
+// Function to get the configured lead times of schedule notices, longest first
+func notificationLeadTimes() []time.Duration {
+	configured := getSettings().Notifications.LeadTimes
+	if configured == nil {
+		return []time.Duration{defaultNoticeLeadTime}
+	}
+	var leadTimes []time.Duration
+	for _, value := range configured {
+		leadTime, err := time.ParseDuration(value)
+		if err != nil || leadTime <= 0 || leadTime > 24*time.Hour {
+			logger.Warn("Ignoring invalid notification lead time", "leadTime", value)
+			continue
+		}
+		leadTimes = append(leadTimes, leadTime)
+	}
+	slices.Sort(leadTimes)
+	slices.Reverse(leadTimes)
+	return leadTimes
+}
+
+// Function to send notices ahead of schedule windows for as long as the process runs
+func startScheduleNotifier(schedulesFile string) {
+	leadTimes := notificationLeadTimes()
+	if getSettings().Notifications.Disabled || len(leadTimes) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(scheduleNoticeInterval)
+		defer ticker.Stop()
+		last := time.Now()
+		for now := range ticker.C {
+			notifyUpcomingSchedules(schedulesFile, leadTimes, last, now)
+			last = now
+		}
+	}()
+}
+
+// Function to send a notice for every schedule or calendar window whose notice time, its start minus a lead time,
+// falls after from and up to to
+func notifyUpcomingSchedules(schedulesFile string, leadTimes []time.Duration, from time.Time, to time.Time) {
+	headerSchedule, err := readScheduleYamlFile(schedulesFile)
+	if err != nil {
+		logger.Error("Error reading schedules for notices", "file", schedulesFile, "error", err)
+		return
+	}
+	// Lead times are sorted longest first
+	windows, err := allScheduleWindows(headerSchedule, from, to.Add(leadTimes[0]))
+	if err != nil {
+		logger.Error("Error reading calendars for notices", "error", err)
+	}
+	for _, window := range windows {
+		for _, leadTime := range leadTimes {
+			if noticeTime := window.Start.Add(-leadTime); noticeTime.After(from) && !noticeTime.After(to) {
+				sendDesktopNotification(fmt.Sprintf("%s starts in %s", window.Name, leadTime), describeScheduleWindow(window))
+			}
+		}
+	}
+}
@@ -2,58 +2,154 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/term"
 )
 
+// PasswordHashSettings selects the algorithm and parameters used for new password hashes
+type PasswordHashSettings struct {
+	Algorithm   string `yaml:"algorithm,omitempty"`   // argon2id (default) or bcrypt
+	Memory      uint32 `yaml:"memory,omitempty"`      // argon2id memory in KiB
+	Iterations  uint32 `yaml:"iterations,omitempty"`  // argon2id passes over memory
+	Parallelism uint8  `yaml:"parallelism,omitempty"` // argon2id threads
+	BcryptCost  int    `yaml:"bcryptCost,omitempty"`
+}
+
+// argon2idParams are the parameters encoded in an argon2id hash
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
 func getPasswordFilePath() string {
 	return passwordFilePath
 }
 
-// Function to hash password
+// Function to get the configured hash settings with defaults filled in
+func getPasswordHashSettings() PasswordHashSettings {
+	hashSettings := getSettings().PasswordHash
+	if hashSettings.Algorithm == "" {
+		hashSettings.Algorithm = hashAlgorithmArgon2id
+	}
+	if hashSettings.Memory == 0 {
+		hashSettings.Memory = 64 * 1024
+	}
+	if hashSettings.Iterations == 0 {
+		hashSettings.Iterations = 3
+	}
+	if hashSettings.Parallelism == 0 {
+		hashSettings.Parallelism = 4
+	}
+	if hashSettings.BcryptCost == 0 {
+		hashSettings.BcryptCost = 14
+	}
+	return hashSettings
+}
+
+// Function to hash password. Hashes are self-describing: argon2id hashes use the PHC string
+// format ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and bcrypt hashes keep their $2a$cost$ prefix
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	hashSettings := getPasswordHashSettings()
+	if hashSettings.Algorithm == hashAlgorithmBcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), hashSettings.BcryptCost)
+		return string(bytes), err
+	}
+	if hashSettings.Algorithm != hashAlgorithmArgon2id {
+		return "", fmt.Errorf("unsupported password hash algorithm %q", hashSettings.Algorithm)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, hashSettings.Iterations, hashSettings.Memory, hashSettings.Parallelism, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hashSettings.Memory, hashSettings.Iterations, hashSettings.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Function to parse an argon2id hash in PHC string format
+func parseArgon2idHash(hash string) (argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != hashAlgorithmArgon2id {
+		return argon2idParams{}, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idParams{}, fmt.Errorf("unsupported argon2id version")
+	}
+	var params argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return argon2idParams{}, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2idParams{}, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return argon2idParams{}, fmt.Errorf("invalid argon2id key: %v", err)
+	}
+	return params, nil
 }
 
 // Function to verify if password matches stored value
 func checkPassword(password, hash string) bool {
+	hash = strings.TrimSpace(hash)
+	if strings.HasPrefix(hash, "$"+hashAlgorithmArgon2id+"$") {
+		params, err := parseArgon2idHash(hash)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(key, params.key) == 1
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-// ValidatePassword checks if the password meets the security requirements
-func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters long")
+// Function to check if a stored hash was made with a different algorithm or parameters than configured
+func passwordNeedsRehash(hash string) bool {
+	hash = strings.TrimSpace(hash)
+	hashSettings := getPasswordHashSettings()
+	if strings.HasPrefix(hash, "$"+hashAlgorithmArgon2id+"$") {
+		params, err := parseArgon2idHash(hash)
+		return err != nil || hashSettings.Algorithm != hashAlgorithmArgon2id ||
+			params.memory != hashSettings.Memory || params.iterations != hashSettings.Iterations || params.parallelism != hashSettings.Parallelism
 	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || hashSettings.Algorithm != hashAlgorithmBcrypt || cost != hashSettings.BcryptCost
+}
 
-	// Check for at least one uppercase letter
-	if matched, _ := regexp.MatchString("[A-Z]", password); !matched {
-		return fmt.Errorf("password must contain at least one uppercase letter")
+// Function to replace an outdated hash after the password was verified, so parameter upgrades apply on next login
+func rehashIfOutdated(filename string, password string, hash string) {
+	if !passwordNeedsRehash(hash) {
+		return
 	}
-
-	// Check for at least one lowercase letter
-	if matched, _ := regexp.MatchString("[a-z]", password); !matched {
-		return fmt.Errorf("password must contain at least one lowercase letter")
+	newHash, err := hashPassword(password)
+	if err != nil {
+		fmt.Printf("Error upgrading password hash: %v\n", err)
+		return
 	}
-
-	// Check for at least one digit
-	if matched, _ := regexp.MatchString("[0-9]", password); !matched {
-		return fmt.Errorf("password must contain at least one digit")
+	// Keep the modification time, it tells how old the password is for the maximum password age
+	info, statErr := os.Stat(filename)
+	if err := os.WriteFile(filename, []byte(newHash), 0600); err != nil {
+		fmt.Printf("Error saving upgraded password hash: %v\n", err)
+		return
 	}
-
-	// Check for at least one special character
-	if matched, _ := regexp.MatchString("[!@#$%^&*(),.?\":{}|<>]", password); !matched {
-		return fmt.Errorf("password must contain at least one special character")
+	if statErr == nil {
+		os.Chtimes(filename, info.ModTime(), info.ModTime())
 	}
-
-	return nil
 }
 
 // Function to create password
@@ -62,9 +158,16 @@ func createPassword(reader *bufio.Reader) error {
 	password, _ := reader.ReadString('\n')
 	password = strings.TrimSpace(password)
 
-	// Validate the new password
+	// Validate the new password against the policy, listing every rule it fails
+	var errs []error
 	if err := ValidatePassword(password); err != nil {
-		return fmt.Errorf("password validation failed: %v", err)
+		errs = append(errs, err)
+	}
+	if hashedBytes, err := os.ReadFile(getPasswordFilePath()); err == nil && checkPassword(password, string(hashedBytes)) {
+		errs = append(errs, fmt.Errorf("must differ from the current password"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return policyError("password", err)
 	}
 
 	fmt.Print("Confirm password: ")
@@ -85,21 +188,38 @@ func createPassword(reader *bufio.Reader) error {
 	if err != nil {
 		return fmt.Errorf("error saving password: %v", err)
 	}
+	auditLog(actionChangePassword, "password", nil, nil, "")
 
 	return nil
 }
 
 // Function to get password from user and verify it
 func verifyPassword(reader *bufio.Reader) bool {
+	verified, _ := verifyPasswordReplacing(reader)
+	return verified
+}
+
+// Function to verify the password, also telling whether a new password was created because it was missing or expired
+func verifyPasswordReplacing(reader *bufio.Reader) (bool, bool) {
 	// Read stored password hash
 	hashedBytes, err := os.ReadFile(getPasswordFilePath())
 	if err != nil {
+		if blockingSessionActive() {
+			fmt.Println("Password file is missing while sites are blocked, a new password can be created once the block ends")
+			return false, false
+		}
 		fmt.Println("No password set. Please create a password first.")
 		if err := createPassword(reader); err != nil {
 			fmt.Printf("Error creating password: %v\n", err)
-			return false
+			return false, false
 		}
-		return true
+		return true, true
+	}
+
+	// Refuse to prompt while locked out
+	if err := authLockedOut(); err != nil {
+		fmt.Printf("Password rejected: %v\n", err)
+		return false, false
 	}
 
 	// Get password from user
@@ -107,7 +227,7 @@ func verifyPassword(reader *bufio.Reader) bool {
 	bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
 		fmt.Println("\nError reading password:", err)
-		return false
+		return false, false
 	}
 
 	fmt.Println() // Print a newline after password input
@@ -116,19 +236,41 @@ func verifyPassword(reader *bufio.Reader) bool {
 	password := strings.TrimSpace(string(bytePassword))
 
 	// Verify password
-	if !checkPassword(password, string(hashedBytes)) {
-		fmt.Println("Incorrect password")
-		return false
+	if err := authenticate(password, string(hashedBytes)); err != nil {
+		fmt.Printf("Password rejected: %v\n", err)
+		return false, false
+	}
+	rehashIfOutdated(getPasswordFilePath(), password, string(hashedBytes))
+
+	// An expired password has to be replaced before the menu can be used
+	if expired, maxAge := passwordExpired(); expired {
+		fmt.Printf("Password is older than the maximum password age of %s, please create a new one\n", maxAge)
+		if err := createPassword(reader); err != nil {
+			fmt.Printf("Error creating password: %v\n", err)
+			return false, false
+		}
+		return true, true
 	}
 
-	return true
+	return true, false
 }
 
 // Function to change password and rewrite to file
 func changePassword(reader *bufio.Reader) error {
-	// Verify current password first
-	if !verifyPassword(reader) {
-		return fmt.Errorf("current password verification failed")
+	// Verify current password first, or the admin secret when an accountability partner holds it
+	if adminSecretEnabled() {
+		if !authorize(reader, actionChangePassword) {
+			return fmt.Errorf("admin secret verification failed")
+		}
+	} else {
+		verified, replaced := verifyPasswordReplacing(reader)
+		if !verified || !verifySecondFactor(reader) {
+			return fmt.Errorf("current password verification failed")
+		}
+		// The password was just replaced because it was missing or expired, don't ask for another one
+		if replaced {
+			return nil
+		}
 	}
 
 	return createPassword(reader)
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Pending unblocks last read from each config file, re-read when the file changes
+var (
+	storedPendingMu    sync.Mutex
+	storedPendingFiles = make(map[string]storedPendingFile)
+)
+
+type storedPendingFile struct {
+	modTime time.Time
+	size    int64
+	pending map[string]string // Site url, or the allowlist key, to its pending unblock time
+}
+
+// Function to register a pending unblock for the timer goroutine of a site
+func setPendingUnblock(url string, at time.Time) {
+	mu.Lock()
+	pendingUnblocks[url] = at
+	mu.Unlock()
+}
+
+// Function to drop a pending unblock so the site stays blocked until expiry
+func clearPendingUnblock(url string) {
+	mu.Lock()
+	delete(pendingUnblocks, url)
+	mu.Unlock()
+}
+
+// Function to check if the cooldown of a pending unblock has passed. The pending unblock is re-read from the config,
+// so an unblock cancelled or requested by another process reaches the process holding the blocks
+func pendingUnblockDue(url string) bool {
+	pendingUnblock, err := storedPendingUnblock(url)
+	if err != nil {
+		logger.Error("Error reading pending unblock", "site", url, "error", err)
+	} else if pendingUnblock == "" {
+		clearPendingUnblock(url)
+	} else {
+		restorePendingUnblock(url, pendingUnblock)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	at, exists := pendingUnblocks[url]
+	return exists && time.Now().After(at)
+}
+
+// Function to get the pending unblock of a site, or of allowlist mode, as stored in its config file.
+// The file is only parsed again once it has changed
+func storedPendingUnblock(url string) (string, error) {
+	path := blockedSitesFilePath
+	if url == allowlistContextKey {
+		path = allowlistFilePath
+	}
+	// Fall back to the absolute path when started by systemd outside the application directory
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		path = absolutePathToSelfControl + "/" + path
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	storedPendingMu.Lock()
+	defer storedPendingMu.Unlock()
+	stored, exists := storedPendingFiles[path]
+	if !exists || !stored.modTime.Equal(info.ModTime()) || stored.size != info.Size() {
+		stored = storedPendingFile{modTime: info.ModTime(), size: info.Size(), pending: make(map[string]string)}
+		if url == allowlistContextKey {
+			allowlist, err := readAllowlistYamlFile(path)
+			if err != nil {
+				return "", err
+			}
+			stored.pending[allowlistContextKey] = allowlist.PendingUnblock
+		} else {
+			headerSites, err := readBlockedYamlFile(path)
+			if err != nil {
+				return "", err
+			}
+			for _, site := range headerSites.Sites {
+				stored.pending[site.URL] = site.PendingUnblock
+			}
+		}
+		storedPendingFiles[path] = stored
+	}
+	return stored.pending[url], nil
+}
+
+// Function to restore a pending unblock stored in the config after a restart
+func restorePendingUnblock(url string, pendingUnblock string) {
+	if pendingUnblock == "" {
+		return
+	}
+	at, err := time.Parse(DateTimeLayout, pendingUnblock)
+	if err != nil {
+		logger.Error("Error parsing pending unblock time", "site", url, "pendingUnblock", pendingUnblock, "error", err)
+		return
+	}
+	setPendingUnblock(url, at)
+}
+
+// Function to request unblocking one or all sites.
+// Without a cooldown configured the sites are unblocked straight away, otherwise the unblock
+// is recorded as pending and carried out by the timer goroutines once the cooldown has passed
+func requestUnblock(filename string, all bool, url string) (time.Time, error) {
+	cooldown := settingsDuration(getSettings().UnblockCooldown)
+	if cooldown <= 0 {
+		return time.Time{}, cleanup(all, url)
+	}
+	if err := checkSitesUnlocked(filename, all, url); err != nil {
+		return time.Time{}, err
+	}
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer unlock()
+	var allowlist HeaderAllowlist
+	if all {
+		if unlockAllowlist, err := lockConfigFile(allowlistFilePath); err == nil {
+			defer unlockAllowlist()
+		}
+		allowlist, _ = readAllowlistYamlFile(allowlistFilePath)
+		if isAllowlistLockActive(allowlist) {
+			return time.Time{}, fmt.Errorf("%w: allowlist mode (until %s)", errBlockLocked, displayStoredTime(allowlist.Expiry))
+		}
+	}
+
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at := time.Now().Add(cooldown)
+	latest := time.Time{} // Time by which every requested unblock will have been carried out
+	found := false
+	for i := range headerSites.Sites {
+		site := &headerSites.Sites[i]
+		if (!all && site.URL != url) || !site.CurrentlyBlocked {
+			continue
+		}
+		found = true
+		// Requesting again does not restart the cooldown
+		if site.PendingUnblock == "" {
+			site.PendingUnblock = formatStoredTime(at)
+		}
+		restorePendingUnblock(site.URL, site.PendingUnblock)
+		if pendingAt, err := time.Parse(DateTimeLayout, site.PendingUnblock); err == nil && pendingAt.After(latest) {
+			latest = pendingAt
+		}
+	}
+
+	if all && allowlist.Active {
+		found = true
+		if allowlist.PendingUnblock == "" {
+			allowlist.PendingUnblock = formatStoredTime(at)
+		}
+		restorePendingUnblock(allowlistContextKey, allowlist.PendingUnblock)
+		if pendingAt, err := time.Parse(DateTimeLayout, allowlist.PendingUnblock); err == nil && pendingAt.After(latest) {
+			latest = pendingAt
+		}
+		if err := writeAndSave(allowlistFilePath, allowlist); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if !found {
+		if all {
+			return time.Time{}, fmt.Errorf("no sites are currently blocked")
+		}
+		return time.Time{}, fmt.Errorf("%s is not currently blocked", url)
+	}
+	if err := writeAndSave(filename, headerSites); err != nil {
+		return time.Time{}, err
+	}
+	target := url
+	if all {
+		target = "all"
+	}
+	auditLog(auditUnblockRequest, target, nil, formatStoredTime(latest), "cooldown "+cooldown.String())
+	return latest, nil
+}
+
+// Function to unblock a site before it is deleted or dropped from its group. With a cooldown configured a blocked
+// site cannot be removed straight away: the unblock is requested and the time it is carried out is returned
+func unblockBeforeRemoval(filename string, url string) (time.Time, error) {
+	blocked := false
+	if headerSites, err := readBlockedYamlFile(filename); err == nil {
+		for _, site := range headerSites.Sites {
+			blocked = blocked || (site.URL == url && site.CurrentlyBlocked)
+		}
+	}
+	if !blocked || settingsDuration(getSettings().UnblockCooldown) <= 0 {
+		return time.Time{}, cleanup(false, url)
+	}
+	return requestUnblock(filename, false, url)
+}
+
+// Function to cancel all pending unblocks so the blocks run until they expire
+func cancelPendingUnblocks(filename string) (int, error) {
+	unlock, err := lockConfigFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	headerSites, err := readBlockedYamlFile(filename)
+	if err != nil {
+		unlock()
+		return 0, err
+	}
+	cancelled := 0
+	for i := range headerSites.Sites {
+		if headerSites.Sites[i].PendingUnblock != "" {
+			headerSites.Sites[i].PendingUnblock = ""
+			clearPendingUnblock(headerSites.Sites[i].URL)
+			cancelled++
+		}
+	}
+	err = writeAndSave(filename, headerSites)
+	unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if unlockAllowlist, err := lockConfigFile(allowlistFilePath); err == nil {
+		defer unlockAllowlist()
+	}
+	allowlist, err := readAllowlistYamlFile(allowlistFilePath)
+	if err == nil && allowlist.PendingUnblock != "" {
+		allowlist.PendingUnblock = ""
+		clearPendingUnblock(allowlistContextKey)
+		cancelled++
+		if err := writeAndSave(allowlistFilePath, allowlist); err != nil {
+			return cancelled, err
+		}
+	}
+	if cancelled > 0 {
+		auditLog(auditCancelUnblock, "", nil, nil, fmt.Sprintf("%d pending unblocks cancelled", cancelled))
+	}
+	return cancelled, nil
+}
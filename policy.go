@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PasswordPolicySettings configures the rules new passwords and admin secrets have to meet
+type PasswordPolicySettings struct {
+	MinLength       int      `yaml:"minLength,omitempty"`       // Minimum number of characters, defaults to 8
+	RequiredClasses []string `yaml:"requiredClasses,omitempty"` // Character classes a password must contain, any of upper, lower, digit and special. Defaults to all of them
+	DenylistFile    string   `yaml:"denylistFile,omitempty"`    // File of common passwords, one per line, that are refused
+	MaxAge          string   `yaml:"maxAge,omitempty"`          // How long a password can be used before it has to be changed, e.g. 2160h. Empty never expires
+}
+
+// Character classes a password policy can require
+var passwordClasses = map[string]func(rune) bool{
+	"upper":   unicode.IsUpper,
+	"lower":   unicode.IsLower,
+	"digit":   unicode.IsDigit,
+	"special": func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) },
+}
+
+// Function to get the configured password policy with defaults filled in
+func getPasswordPolicy() PasswordPolicySettings {
+	policy := getSettings().PasswordPolicy
+	if policy.MinLength <= 0 {
+		policy.MinLength = 8
+	}
+	if policy.RequiredClasses == nil {
+		policy.RequiredClasses = []string{"upper", "lower", "digit", "special"}
+	}
+	return policy
+}
+
+// Function to get the denylist file, resolving a relative path against the app directory like the other config files
+func getDenylistFilePath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	if _, err := os.Stat(filepath.Dir(filename)); err != nil {
+		return absolutePathToSelfControl + "/" + filename
+	}
+	return filename
+}
+
+// Function to check if a password is in the denylist file, compared case-insensitively
+func passwordDenylisted(filename string, password string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.EqualFold(strings.TrimSpace(scanner.Text()), password) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// ValidatePassword checks the password against every rule of the password policy and
+// returns all failed rules joined together, so they can be fixed in one go
+func ValidatePassword(password string) error {
+	policy := getPasswordPolicy()
+	var errs []error
+
+	if length := len([]rune(password)); length < policy.MinLength {
+		errs = append(errs, fmt.Errorf("must be at least %d characters long, got %d", policy.MinLength, length))
+	}
+
+	for _, class := range policy.RequiredClasses {
+		isClass, exists := passwordClasses[class]
+		if !exists {
+			errs = append(errs, fmt.Errorf("unknown character class %q in password policy", class))
+			continue
+		}
+		if !strings.ContainsFunc(password, isClass) {
+			errs = append(errs, fmt.Errorf("must contain at least one %s character", class))
+		}
+	}
+
+	if policy.DenylistFile != "" {
+		denylistFile := getDenylistFilePath(policy.DenylistFile)
+		denylisted, err := passwordDenylisted(denylistFile, password)
+		if err != nil {
+			// A missing denylist should not stop passwords from being set, the other rules still apply
+			logger.Warn("Could not read the password denylist, skipping it", "file", denylistFile, "error", err)
+		} else if denylisted {
+			errs = append(errs, fmt.Errorf("must not be a commonly used password"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Function to format failed policy rules as a list, one rule per line
+func policyError(subject string, err error) error {
+	return fmt.Errorf("%s does not meet the password policy:\n  - %s", subject, strings.ReplaceAll(err.Error(), "\n", "\n  - "))
+}
+
+// Function to check if the password file is older than the maximum password age
+func passwordExpired() (bool, time.Duration) {
+	maxAge := settingsDuration(getPasswordPolicy().MaxAge)
+	if maxAge <= 0 {
+		return false, 0
+	}
+	info, err := os.Stat(getPasswordFilePath())
+	if err != nil {
+		return false, 0
+	}
+	return time.Since(info.ModTime()) > maxAge, maxAge
+}
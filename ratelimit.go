@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AuthState keeps track of failed password and code attempts across restarts, and whether an admin secret was ever set
+// so that deleting the secret file does not quietly hand the admin role back to the user
+type AuthState struct {
+	FailedAttempts  int    `yaml:"failedAttempts"`
+	LastFailure     string `yaml:"lastFailure,omitempty"`
+	FailedCodes     int    `yaml:"failedCodes,omitempty"` // Wrong two-factor or recovery codes, counted apart from passwords
+	LastCodeFailure string `yaml:"lastCodeFailure,omitempty"`
+	LockedUntil     string `yaml:"lockedUntil,omitempty"`
+	AdminSecretSet  bool   `yaml:"adminSecretSet,omitempty"`
+}
+
+// Factors that are rate limited, named in the audit log
+const (
+	authFactorPassword = "password"
+	authFactorCode     = "code"
+)
+
+// Returned when a password or code attempt is rejected because of too many failures
+var errAuthLockedOut = errors.New("too many failed login attempts")
+
+// Function to read the auth state file, a missing file means no failed attempts
+func readAuthState(filename string) (AuthState, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return AuthState{}, nil
+	}
+	if err != nil {
+		return AuthState{}, err
+	}
+	var state AuthState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return AuthState{}, err
+	}
+	return state, nil
+}
+
+// Function to write the auth state file, readable only by its owner
+func writeAuthState(filename string, state AuthState) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// Function to get the delay required after the given number of consecutive failures
+func passwordBackoff(failedAttempts int) time.Duration {
+	if failedAttempts <= 0 {
+		return 0
+	}
+	backoff := passwordBackoffBase
+	for i := 1; i < failedAttempts && backoff < passwordBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, passwordBackoffMax)
+}
+
+// Function to check if password attempts are locked out, the error says until when
+func authLockedOut() error {
+	state, err := readAuthState(authStateFilePath)
+	if err != nil || state.LockedUntil == "" {
+		return nil
+	}
+	lockedUntil, err := time.Parse(DateTimeLayout, state.LockedUntil)
+	if err != nil || !time.Now().Before(lockedUntil) {
+		return nil
+	}
+	return fmt.Errorf("%w, locked out until %s", errAuthLockedOut, displayStoredTime(state.LockedUntil))
+}
+
+// Function to check a password against the stored hash with backoff, lockout and failure logging.
+// Every caller that accepts a password, interactive or not, should go through this function
+func authenticate(password string, hash string) error {
+	return rateLimited(authFactorPassword, func() bool { return checkPassword(password, hash) })
+}
+
+// Function to check a two-factor or recovery code with the same backoff, lockout and failure logging as passwords.
+// Codes keep their own failure count, so a correct password does not reset the count of wrong codes
+func authenticateCode(check func() bool) error {
+	return rateLimited(authFactorCode, check)
+}
+
+// Function to run a credential check for a factor, waiting out the backoff from its previous failure first
+// and locking out every factor once it has failed too often
+func rateLimited(factor string, check func() bool) error {
+	if err := authLockedOut(); err != nil {
+		return err
+	}
+
+	state, err := readAuthState(authStateFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading auth state: %v", err)
+	}
+	failedAttempts, lastFailure := &state.FailedAttempts, &state.LastFailure
+	if factor == authFactorCode {
+		failedAttempts, lastFailure = &state.FailedCodes, &state.LastCodeFailure
+	}
+
+	// Wait out the backoff from the previous failure before checking
+	if last, err := time.Parse(DateTimeLayout, *lastFailure); err == nil {
+		if wait := time.Until(last.Add(passwordBackoff(*failedAttempts))); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+
+	if check() {
+		if *failedAttempts > 0 || state.LockedUntil != "" {
+			*failedAttempts, *lastFailure, state.LockedUntil = 0, "", ""
+			if err := writeAuthState(authStateFilePath, state); err != nil {
+				fmt.Printf("Error resetting auth state: %v\n", err)
+			}
+		}
+		return nil
+	}
+
+	settings := getSettings()
+	maxAttempts := settings.MaxPasswordAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultPasswordAttempts
+	}
+	lockout := settingsDuration(settings.PasswordLockout)
+	if lockout <= 0 {
+		lockout = defaultPasswordLockout
+	}
+
+	*failedAttempts++
+	*lastFailure = formatStoredTime(time.Now())
+	attempts := *failedAttempts
+	lockedOut := attempts >= maxAttempts
+	if lockedOut {
+		state.LockedUntil = formatStoredTime(time.Now().Add(lockout))
+		*failedAttempts = 0
+	}
+	if err := writeAuthState(authStateFilePath, state); err != nil {
+		fmt.Printf("Error saving auth state: %v\n", err)
+	}
+	if lockedOut {
+		logAuthFailure(factor, attempts, state.LockedUntil)
+	} else {
+		logAuthFailure(factor, attempts, "")
+	}
+
+	if lockedOut {
+		return fmt.Errorf("%w, locked out until %s", errAuthLockedOut, displayStoredTime(state.LockedUntil))
+	}
+	if factor == authFactorCode {
+		return fmt.Errorf("invalid authentication code")
+	}
+	return fmt.Errorf("incorrect password")
+}
+
+// Function to record a failed password or code attempt in the audit log
+func logAuthFailure(factor string, attempts int, lockedUntil string) {
+	countFailedAttempt()
+	detail := fmt.Sprintf("failed %s attempt %d", factor, attempts)
+	if lockedUntil != "" {
+		detail += ", locked out until " + lockedUntil
+	}
+	auditLog(auditAuthFailure, "", nil, nil, detail)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Roles an action can require. The user role is granted by logging in, the admin role needs
+// the admin secret when one is set so that an accountability partner can hold it
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// Actions that need a role check
+const (
+	actionViewStatus      = "view-status"
+	actionBlock           = "block"
+	actionExtend          = "extend"
+	actionShorten         = "shorten"
+	actionUnblock         = "unblock"
+	actionDeleteSite      = "delete-site"
+	actionResyncGroup     = "resync-group"
+	actionImportBundle    = "import-bundle"
+	actionEditSchedule    = "edit-schedule"
+	actionDeleteSchedule  = "delete-schedule"
+	actionSkipSchedule    = "skip-schedule"
+	actionAllowDomain     = "allow-domain"
+	actionChangePassword  = "change-password"
+	actionSetAdminSecret  = "set-admin-secret"
+	actionEnrollTwoFactor = "enroll-two-factor"
+)
+
+// Role required for each action, anything that weakens blocking needs the admin role
+var actionRoles = map[string]string{
+	actionViewStatus:      roleUser,
+	actionBlock:           roleUser,
+	actionExtend:          roleUser,
+	actionShorten:         roleAdmin,
+	actionUnblock:         roleAdmin,
+	actionDeleteSite:      roleAdmin,
+	actionResyncGroup:     roleAdmin,
+	actionImportBundle:    roleAdmin,
+	actionEditSchedule:    roleAdmin,
+	actionDeleteSchedule:  roleAdmin,
+	actionSkipSchedule:    roleAdmin,
+	actionAllowDomain:     roleAdmin,
+	actionChangePassword:  roleAdmin,
+	actionSetAdminSecret:  roleAdmin,
+	actionEnrollTwoFactor: roleAdmin,
+}
+
+// Function to check if an admin secret separate from the login password has been set
+func adminSecretEnabled() bool {
+	_, err := os.Stat(adminPasswordFilePath)
+	return err == nil
+}
+
+// Function to check if the admin secret file is gone after an admin secret was set. While a block is
+// running this refuses admin actions instead of falling back to the login password
+func adminSecretRemoved() bool {
+	state, err := readAuthState(authStateFilePath)
+	return err == nil && state.AdminSecretSet && !adminSecretEnabled()
+}
+
+// Function to check the caller holds the role required for an action.
+// Without an admin secret the logged in user is their own admin, so only the second factor is asked for
+func authorize(reader *bufio.Reader, action string) bool {
+	role, exists := actionRoles[action]
+	if !exists {
+		role = roleAdmin // Unknown actions default to the stricter role
+	}
+	if role == roleUser {
+		return true
+	}
+
+	hashedBytes, err := os.ReadFile(adminPasswordFilePath)
+	if err != nil {
+		if adminSecretRemoved() && blockingSessionActive() {
+			fmt.Println("The admin secret is missing, admin actions are refused until the block ends")
+			return false
+		}
+		return verifyPrivileged(reader)
+	}
+
+	fmt.Printf("Admin secret required to %s: ", strings.ReplaceAll(action, "-", " "))
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		fmt.Println("Error reading admin secret:", err)
+		return false
+	}
+	if err := authenticate(strings.TrimSpace(string(secret)), string(hashedBytes)); err != nil {
+		fmt.Printf("Admin secret rejected: %v\n", err)
+		return false
+	}
+	rehashIfOutdated(adminPasswordFilePath, strings.TrimSpace(string(secret)), string(hashedBytes))
+	return verifySecondFactor(reader)
+}
+
+// Function to set the admin secret, stored separately from the login password
+func setAdminSecret(reader *bufio.Reader) error {
+	// The first admin secret can be set by the user, replacing it needs the current one
+	if adminSecretEnabled() {
+		if !authorize(reader, actionSetAdminSecret) {
+			return fmt.Errorf("admin secret verification failed")
+		}
+	} else if adminSecretRemoved() && blockingSessionActive() {
+		return fmt.Errorf("the admin secret is missing, it can be set again once the block ends")
+	} else if !verifyPassword(reader) || !verifySecondFactor(reader) {
+		return fmt.Errorf("password verification failed")
+	}
+
+	fmt.Print("Create new admin secret: ")
+	secret := readUserInput(reader)
+	if err := ValidatePassword(secret); err != nil {
+		return policyError("admin secret", err)
+	}
+	fmt.Print("Confirm admin secret: ")
+	if readUserInput(reader) != secret {
+		return fmt.Errorf("admin secrets do not match")
+	}
+
+	hashedSecret, err := hashPassword(secret)
+	if err != nil {
+		return fmt.Errorf("error hashing admin secret: %v", err)
+	}
+	if err := os.WriteFile(adminPasswordFilePath, []byte(hashedSecret), 0600); err != nil {
+		return fmt.Errorf("error saving admin secret: %v", err)
+	}
+	state, err := readAuthState(authStateFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading auth state: %v", err)
+	}
+	state.AdminSecretSet = true
+	if err := writeAuthState(authStateFilePath, state); err != nil {
+		return fmt.Errorf("error saving auth state: %v", err)
+	}
+	// Records from here on are signed with a key only the admin secret can reproduce
+	if err := rotateAuditKey(secret); err != nil {
+		return fmt.Errorf("error keying the audit log with the new admin secret: %v", err)
+	}
+	return nil
+}
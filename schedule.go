@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scheduleWindow is one concrete window of a schedule or of a calendar event
+type scheduleWindow struct {
+	Name   string // Name of the schedule or calendar
+	Title  string // Title of the calendar event, empty for schedules
+	Mode   string
+	Locked bool
+	Start  time.Time
+	End    time.Time
+}
+
+// Function to get the time zone of a schedule, local time when none is set or it cannot be loaded
+func scheduleLocation(schedule Schedule) *time.Location {
+	if schedule.TimeZone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		logger.Warn("Unknown schedule time zone, using local time", "schedule", schedule.Name, "timeZone", schedule.TimeZone, "error", err)
+		return time.Local
+	}
+	return location
+}
+
+// Function to list the windows of a schedule starting on the day of the given time, from its cron expression
+// or from its days and times. Nothing is returned on days outside the schedule's validity ranges
+func scheduleWindowsOn(schedule Schedule, day time.Time) [][2]time.Time {
+	if !scheduleValidOn(schedule, day) {
+		return nil
+	}
+	if schedule.Cron != "" {
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return nil
+		}
+		duration, err := parseWindowDuration(schedule.Duration)
+		if err != nil {
+			return nil
+		}
+		var windows [][2]time.Time
+		for _, start := range cron.startsOn(day) {
+			windows = append(windows, [2]time.Time{start, start.Add(duration)})
+		}
+		return windows
+	}
+	if !slices.Contains(schedule.Days, strings.ToLower(day.Weekday().String())) {
+		return nil
+	}
+	start, errStart := time.Parse("15:04", schedule.StartTime)
+	end, errEnd := time.Parse("15:04", schedule.EndTime)
+	if errStart != nil || errEnd != nil {
+		return nil
+	}
+	return [][2]time.Time{{wallClockTime(day, start.Hour(), start.Minute()), wallClockTime(day, end.Hour(), end.Minute())}}
+}
+
+// Function to get a wall clock time on the day of the given time in its location. A time skipped when the clocks
+// go forward for daylight saving moves to the moment they jump, where time.Date would move it before or past the jump
+func wallClockTime(day time.Time, hour int, minute int) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	if t.Hour() == hour && t.Minute() == minute {
+		return t
+	}
+	start, end := t.ZoneBounds()
+	requested := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+	if time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Before(requested) {
+		return end // Still in the zone before the jump
+	}
+	return start
+}
+
+// Function to check if the day of the given time falls inside one of the schedule's validity ranges, always true without any
+func scheduleValidOn(schedule Schedule, day time.Time) bool {
+	if len(schedule.Valid) == 0 {
+		return true
+	}
+	date := day.Format(dateLayout)
+	for _, valid := range schedule.Valid {
+		if validRange, err := parseDateRange(valid); err == nil && validRange.contains(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// dateRange is an inclusive range of days in YYYY-MM-DD form, a single day has From equal to To
+type dateRange struct {
+	From string
+	To   string
+	Name string // Name of a holiday, empty for schedule exceptions
+}
+
+// Function to parse a day such as 2026-12-24 or a range of days such as 2026-12-24..2027-01-02
+func parseDateRange(value string) (dateRange, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(value), "..")
+	if !isRange {
+		to = from
+	}
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(dateLayout, day); err != nil {
+			return dateRange{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD", value)
+		}
+	}
+	if to < from {
+		return dateRange{}, fmt.Errorf("date range %q ends before it starts", value)
+	}
+	return dateRange{From: from, To: to}, nil
+}
+
+// Function to check if a day in YYYY-MM-DD form falls inside the range
+func (r dateRange) contains(day string) bool {
+	return r.From <= day && day <= r.To
+}
+
+// Function to describe a range, e.g. "2026-12-24..2027-01-02 (Christmas)"
+func (r dateRange) String() string {
+	value := r.From
+	if r.To != r.From {
+		value += ".." + r.To
+	}
+	if r.Name != "" {
+		value += " (" + r.Name + ")"
+	}
+	return value
+}
+
+// Function to read the holiday file, one day or range of days per line optionally followed by a name.
+// Empty lines and lines starting with # are skipped
+func readHolidays(filename string) ([]dateRange, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var holidays []dateRange
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		value, name, _ := strings.Cut(text, " ")
+		holiday, err := parseDateRange(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filename, line, err)
+		}
+		holiday.Name = strings.TrimSpace(name)
+		holidays = append(holidays, holiday)
+	}
+	return holidays, scanner.Err()
+}
+
+// Function to get the global holidays no schedule runs on, falling back to the absolute path when started
+// by systemd outside the application directory. A missing holiday file means there are no holidays
+func getHolidays() []dateRange {
+	path := holidaysFilePath
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		path = absolutePathToSelfControl + "/" + holidaysFilePath
+	}
+	holidays, err := readHolidays(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Error("Error reading holiday file", "file", path, "error", err)
+	}
+	return holidays
+}
+
+// Function to get why a schedule does not run at the given time, empty when it runs. A schedule skipped
+// for today only stops running once the skip takes effect after the unblock cooldown
+func scheduleSkipReason(schedule Schedule, holidays []dateRange, at time.Time) string {
+	day := at.In(scheduleLocation(schedule)).Format(dateLayout)
+	if schedule.SkipDate == day {
+		if from, err := time.Parse(DateTimeLayout, schedule.SkipFrom); err != nil || !at.Before(from) {
+			return "skipped today"
+		}
+	}
+	for _, exception := range schedule.Exceptions {
+		if exceptionRange, err := parseDateRange(exception); err == nil && exceptionRange.contains(day) {
+			return "exception " + exceptionRange.String()
+		}
+	}
+	for _, holiday := range holidays {
+		if holiday.contains(day) {
+			return "holiday " + holiday.String()
+		}
+	}
+	return ""
+}
+
+// Function to list the windows of a schedule that overlap from..to, leaving out exception days and holidays.
+// Days are walked in the schedule's time zone, so a window keeps its wall clock times across daylight saving changes
+func scheduleWindows(schedule Schedule, from time.Time, to time.Time) []scheduleWindow {
+	holidays := getHolidays()
+	location := scheduleLocation(schedule)
+	first := from.In(location)
+	var windows []scheduleWindow
+	// Start a day early for the window that is still running at from
+	for day := time.Date(first.Year(), first.Month(), first.Day()-1, 0, 0, 0, 0, location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, window := range scheduleWindowsOn(schedule, day) {
+			start, windowEnd := window[0], window[1]
+			if scheduleSkipReason(schedule, holidays, start) != "" {
+				continue
+			}
+			// Skipping today during the window ends it once the skip takes effect
+			if skipFrom, err := time.Parse(DateTimeLayout, schedule.SkipFrom); err == nil && schedule.SkipDate == day.Format(dateLayout) && skipFrom.Before(windowEnd) {
+				windowEnd = skipFrom
+			}
+			if start.Before(to) && windowEnd.After(from) {
+				windows = append(windows, scheduleWindow{
+					Name:   schedule.Name,
+					Mode:   scheduleMode(schedule),
+					Locked: schedule.Locked,
+					Start:  start,
+					End:    windowEnd,
+				})
+			}
+		}
+	}
+	return windows
+}
+
+// Function to list the windows of every schedule and calendar that overlap from..to, ordered by start.
+// Calendars that cannot be read are reported in the error, the windows of the others are still returned
+func allScheduleWindows(headerSchedule HeaderSchedule, from time.Time, to time.Time) ([]scheduleWindow, error) {
+	var windows []scheduleWindow
+	for _, schedule := range headerSchedule.Schedules {
+		windows = append(windows, scheduleWindows(schedule, from, to)...)
+	}
+	var errs []error
+	for _, calendar := range headerSchedule.Calendars {
+		events, err := calendarWindows(calendar, from, to)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		windows = append(windows, events...)
+	}
+	slices.SortStableFunc(windows, func(a, b scheduleWindow) int { return a.Start.Compare(b.Start) })
+	return windows, errors.Join(errs...)
+}
+
+// Function to list the next windows of the schedules and calendars, the one running at from included. Only the
+// schedule or calendar with the given name is looked at unless the name is empty. The search stops at previewHorizon
+func previewScheduleWindows(headerSchedule HeaderSchedule, name string, from time.Time, count int) ([]scheduleWindow, error) {
+	if name != "" {
+		var selected HeaderSchedule
+		for _, schedule := range headerSchedule.Schedules {
+			if schedule.Name == name {
+				selected.Schedules = append(selected.Schedules, schedule)
+			}
+		}
+		for _, calendar := range headerSchedule.Calendars {
+			if FormatString(calendar.Name) == name {
+				selected.Calendars = append(selected.Calendars, calendar)
+			}
+		}
+		if len(selected.Schedules) == 0 && len(selected.Calendars) == 0 {
+			return nil, fmt.Errorf("Schedule %s not found", name)
+		}
+		headerSchedule = selected
+	}
+
+	var windows []scheduleWindow
+	var calendarErr error
+	// Look a week at a time, windows overlapping the start of a week were found with the week before
+	for weekStart := from; len(windows) < count && weekStart.Before(from.Add(previewHorizon)); weekStart = weekStart.AddDate(0, 0, 7) {
+		week, err := allScheduleWindows(headerSchedule, weekStart, weekStart.AddDate(0, 0, 7))
+		if err != nil && calendarErr == nil {
+			calendarErr = err // The same calendar fails every week, report it once
+		}
+		for _, window := range week {
+			if weekStart.Equal(from) || !window.Start.Before(weekStart) {
+				windows = append(windows, window)
+			}
+		}
+	}
+	if len(windows) > count {
+		windows = windows[:count]
+	}
+	return windows, calendarErr
+}
+
+// Function to describe a window in local time in a line, e.g. "work (block) Mon 2026-10-19 09:00 - 18:00"
+func describeScheduleWindow(window scheduleWindow) string {
+	window.Start, window.End = window.Start.Local(), window.End.Local()
+	name := window.Name
+	if window.Title != "" {
+		name += ": " + window.Title
+	}
+	end := window.End.Format("15:04")
+	if window.End.YearDay() != window.Start.YearDay() || window.End.Year() != window.Start.Year() {
+		end = window.End.Format("Mon 2006-01-02 15:04")
+	}
+	line := name + " (" + window.Mode + ") " + window.Start.Format("Mon 2006-01-02 15:04") + " - " + end
+	if window.Locked {
+		line += " locked"
+	}
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWallClockTime(t *testing.T) {
+	tests := []struct {
+		zone   string
+		day    string
+		hour   int
+		minute int
+		want   string
+	}{
+		{"Europe/Berlin", "2026-03-29", 1, 30, "2026-03-29 01:30 +0100"},
+		// Skipped when the clocks go forward, moves to the moment they jump
+		{"Europe/Berlin", "2026-03-29", 2, 30, "2026-03-29 03:00 +0200"},
+		{"Europe/Berlin", "2026-03-29", 3, 0, "2026-03-29 03:00 +0200"},
+		{"Europe/Berlin", "2026-10-25", 12, 0, "2026-10-25 12:00 +0100"},
+		{"America/New_York", "2026-03-08", 2, 15, "2026-03-08 03:00 -0400"},
+		{"America/New_York", "2026-03-09", 2, 15, "2026-03-09 02:15 -0400"},
+		{"America/Santiago", "2026-09-06", 0, 30, "2026-09-06 01:00 -0300"},
+		{"UTC", "2026-03-29", 2, 30, "2026-03-29 02:30 +0000"},
+	}
+	for _, test := range tests {
+		location, err := time.LoadLocation(test.zone)
+		if err != nil {
+			t.Skipf("time zone data not available: %v", err)
+		}
+		// Noon, midnight does not exist on days the clocks jump at midnight
+		day, _ := time.ParseInLocation("2006-01-02 15:04", test.day+" 12:00", location)
+		if got := wallClockTime(day, test.hour, test.minute).Format("2006-01-02 15:04 -0700"); got != test.want {
+			t.Errorf("%s %s %02d:%02d: got %s, want %s", test.zone, test.day, test.hour, test.minute, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kinds of sources that block sites in a timeline
+const (
+	timelineManual    = "manual"
+	timelineAllowlist = "allowlist"
+	timelineSchedule  = "schedule"
+	timelineCalendar  = "calendar"
+)
+
+// timelineBlock is a stretch of time during which a source blocks sites. In allowlist mode
+// every site is blocked except the listed ones
+type timelineBlock struct {
+	Source string   `json:"source"` // Name of the schedule or calendar, the site of a manual block
+	Kind   string   `json:"kind"`   // manual, allowlist, schedule or calendar
+	Title  string   `json:"title,omitempty"`
+	Mode   string   `json:"mode"`
+	Locked bool     `json:"locked,omitempty"`
+	Sites  []string `json:"sites"`
+	Start  string   `json:"start"`
+	End    string   `json:"end"`
+	start  time.Time
+	end    time.Time
+}
+
+// Timeline shows what is blocked when over a week, with warnings about schedules that get in each other's way
+type Timeline struct {
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Blocks   []timelineBlock `json:"blocks"`
+	Warnings []string        `json:"warnings"`
+	from     time.Time
+	to       time.Time
+}
+
+// Function to build the timeline of from..to out of the manual blocks, allowlist mode and the schedule and calendar windows
+func buildTimeline(headerSites HeaderSite, allowlist HeaderAllowlist, headerSchedule HeaderSchedule, from time.Time, to time.Time) Timeline {
+	timeline := Timeline{From: formatLocalTime(from), To: formatLocalTime(to), Blocks: []timelineBlock{}, Warnings: []string{}, from: from, to: to}
+	var sites []string
+	for _, site := range headerSites.Sites {
+		sites = append(sites, site.URL)
+		if !site.CurrentlyBlocked {
+			continue
+		}
+		if expiry, err := time.Parse(DateTimeLayout, site.Duration); err == nil && expiry.After(from) {
+			timeline.add(timelineBlock{Source: site.URL, Kind: timelineManual, Mode: scheduleModeBlock, Locked: site.Locked, Sites: []string{site.URL}}, from, expiry)
+		}
+	}
+	if allowlist.Active {
+		if expiry, err := time.Parse(DateTimeLayout, allowlist.Expiry); err == nil && expiry.After(from) {
+			timeline.add(timelineBlock{Source: timelineAllowlist, Kind: timelineAllowlist, Mode: scheduleModeAllowlist, Locked: allowlist.Locked, Sites: allowlist.Domains}, from, expiry)
+		}
+	}
+
+	windows, err := allScheduleWindows(headerSchedule, from, to)
+	if err != nil {
+		timeline.Warnings = append(timeline.Warnings, fmt.Sprintf("Calendars left out: %v", err))
+	}
+	for _, window := range windows {
+		block := timelineBlock{Source: window.Name, Kind: timelineSchedule, Title: window.Title, Mode: window.Mode, Locked: window.Locked, Sites: sites}
+		if window.Title != "" {
+			block.Kind = timelineCalendar
+		}
+		if window.Mode == scheduleModeAllowlist {
+			block.Sites = allowlist.Domains
+		}
+		if !window.End.After(window.Start) {
+			timeline.Warnings = append(timeline.Warnings, fmt.Sprintf("%s has a zero-length window at %s", window.Name, window.Start.Local().Format("Mon 2006-01-02 15:04")))
+			continue
+		}
+		timeline.add(block, window.Start, window.End)
+	}
+	timeline.Warnings = append(timeline.Warnings, timelineConflicts(timeline.Blocks)...)
+	return timeline
+}
+
+// Function to read the blocked sites, allowlist and schedules and build the timeline of the week starting on the day of from
+func loadTimeline(from time.Time) (Timeline, error) {
+	headerSites, err := readBlockedYamlFile(blockedSitesFilePath)
+	if err != nil {
+		return Timeline{}, fmt.Errorf("error reading blocked sites: %v", err)
+	}
+	headerSchedule, err := readScheduleYamlFile(schedulesFilePath)
+	if err != nil {
+		return Timeline{}, fmt.Errorf("error reading schedule file: %v", err)
+	}
+	allowlist, err := readAllowlistYamlFile(allowlistFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Timeline{}, fmt.Errorf("error reading allowlist: %v", err)
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	return buildTimeline(headerSites, allowlist, headerSchedule, from, from.AddDate(0, 0, timelineDays)), nil
+}
+
+// Function to add a block to the timeline, cut to the timeline's range
+func (timeline *Timeline) add(block timelineBlock, start time.Time, end time.Time) {
+	block.start, block.end = start, end
+	if block.start.Before(timeline.from) {
+		block.start = timeline.from
+	}
+	if block.end.After(timeline.to) {
+		block.end = timeline.to
+	}
+	if block.Sites == nil {
+		block.Sites = []string{}
+	}
+	block.Start, block.End = formatLocalTime(block.start), formatLocalTime(block.end)
+	timeline.Blocks = append(timeline.Blocks, block)
+}
+
+// Function to warn about schedule and calendar windows in block mode overlapping windows in allowlist mode,
+// one mode blocks the configured sites while the other keeps only the allowlist reachable. Each pair is reported once
+func timelineConflicts(blocks []timelineBlock) []string {
+	type pair struct{ first, second string }
+	overlaps := make(map[pair]int)
+	firstOverlap := make(map[pair]string)
+	var order []pair
+	for i, a := range blocks {
+		for _, b := range blocks[i+1:] {
+			if a.Kind == timelineManual || b.Kind == timelineManual || a.Kind == timelineAllowlist || b.Kind == timelineAllowlist {
+				continue
+			}
+			if a.Source == b.Source || a.Mode == b.Mode || !a.start.Before(b.end) || !b.start.Before(a.end) {
+				continue
+			}
+			key := pair{a.Source, b.Source}
+			if a.Mode == scheduleModeAllowlist {
+				key = pair{b.Source, a.Source}
+			}
+			if overlaps[key] == 0 {
+				order = append(order, key)
+				firstOverlap[key] = fmt.Sprintf("first at %s", later(a.start, b.start).Local().Format("Mon 2006-01-02 15:04"))
+				if allowed := sitesInBoth(a.Sites, b.Sites); len(allowed) > 0 {
+					firstOverlap[key] += ", both block and allow " + strings.Join(allowed, ", ")
+				}
+			}
+			overlaps[key]++
+		}
+	}
+	var warnings []string
+	for _, key := range order {
+		warnings = append(warnings, fmt.Sprintf("%s (block) and %s (allowlist) overlap %d time(s) with conflicting site sets, %s",
+			key.first, key.second, overlaps[key], firstOverlap[key]))
+	}
+	return warnings
+}
+
+// Function to get the later of two times
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Function to list the sites found in both lists, a site blocked by one window and allowed by another
+func sitesInBoth(a []string, b []string) []string {
+	var both []string
+	for _, site := range a {
+		if slices.Contains(b, site) {
+			both = append(both, site)
+		}
+	}
+	return both
+}
+
+// Function to print the timeline as a grid with a row per day and a cell per half hour in local time.
+// Each source gets a letter, * marks cells where more than one source blocks
+func printTimeline(timeline Timeline) {
+	letters := make(map[string]byte)
+	var legend []timelineBlock
+	for _, block := range timeline.Blocks {
+		key := block.Kind + "/" + block.Source
+		if _, exists := letters[key]; exists {
+			continue
+		}
+		letters[key] = timelineLetter(len(legend))
+		legend = append(legend, block)
+	}
+
+	fmt.Printf("Timeline %s - %s (local time, %d minute cells)\n", timeline.from.Format("Mon 2006-01-02"), timeline.to.Add(-time.Second).Format("Mon 2006-01-02"), int(timelineCell/time.Minute))
+	fmt.Print(strings.Repeat(" ", 11))
+	for hour := 0; hour < 24; hour += 3 {
+		fmt.Printf("%-6s", fmt.Sprintf("%02d", hour))
+	}
+	fmt.Println()
+	cellsPerHour := int(time.Hour / timelineCell)
+	for day := timeline.from; day.Before(timeline.to); day = day.AddDate(0, 0, 1) {
+		var row strings.Builder
+		for cell := 0; cell < 24*cellsPerHour; cell++ {
+			minutes := cell * int(timelineCell/time.Minute)
+			start := wallClockTime(day, minutes/60, minutes%60)
+			end := start.Add(timelineCell)
+			mark := byte('.')
+			for _, block := range timeline.Blocks {
+				if block.start.Before(end) && block.end.After(start) {
+					letter := letters[block.Kind+"/"+block.Source]
+					if mark != '.' && mark != letter {
+						mark = '*'
+						break
+					}
+					mark = letter
+				}
+			}
+			row.WriteByte(mark)
+		}
+		fmt.Printf("%s  %s\n", day.Format("Mon 01-02"), row.String())
+	}
+
+	if len(legend) == 0 {
+		fmt.Println("\nNothing is blocked this week")
+	} else {
+		fmt.Println("\nLegend:")
+		for i, block := range legend {
+			describe := block.Kind
+			if block.Kind != timelineManual && block.Kind != timelineAllowlist {
+				describe += ", " + block.Mode
+			}
+			if block.Locked {
+				describe += ", locked"
+			}
+			sites := strings.Join(block.Sites, ", ")
+			if block.Mode == scheduleModeAllowlist {
+				sites = "everything except " + sites
+			}
+			fmt.Printf("%c  %s (%s): %s\n", timelineLetter(i), block.Source, describe, sites)
+		}
+		fmt.Println("*  more than one at once")
+	}
+	if len(timeline.Warnings) > 0 {
+		fmt.Println("\nWarnings:")
+		for _, warning := range timeline.Warnings {
+			fmt.Println("- " + warning)
+		}
+	}
+}
+
+// Function to get the grid letter of the nth source, + once the letters run out
+func timelineLetter(n int) byte {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	if n < len(letters) {
+		return letters[n]
+	}
+	return '+'
+}
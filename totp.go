@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// TOTPConfig holds the enrolled TOTP secret and the hashes of the unused recovery codes
+type TOTPConfig struct {
+	Secret        string   `yaml:"secret"`
+	RecoveryCodes []string `yaml:"recoveryCodes"`
+}
+
+// Function to read the TOTP config, returns false if TOTP is not enrolled
+func readTOTPConfig(filename string) (TOTPConfig, bool, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return TOTPConfig{}, false, nil
+	}
+	if err != nil {
+		return TOTPConfig{}, false, err
+	}
+	var config TOTPConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return TOTPConfig{}, false, err
+	}
+	return config, config.Secret != "", nil
+}
+
+// Function to write the TOTP config, readable only by its owner
+func writeTOTPConfig(filename string, config TOTPConfig) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+// Function to generate a random base32 TOTP secret
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// Function to compute the RFC 6238 code of a secret for the time step containing t
+func totpCode(secret string, t time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/int64(totpPeriod.Seconds())))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as described in RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// Function to check a TOTP code, allowing one time step of clock drift either way
+func verifyTOTPCode(secret string, code string) bool {
+	now := time.Now()
+	for _, drift := range []time.Duration{0, -totpPeriod, totpPeriod} {
+		expected, err := totpCode(secret, now.Add(drift))
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to generate recovery codes, returns the plain codes and their bcrypt hashes
+func generateRecoveryCodes(count int) ([]string, []string, error) {
+	const charset = "abcdefghijkmnpqrstuvwxyz23456789"
+	var codes, hashes []string
+	for i := 0; i < count; i++ {
+		var builder strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				builder.WriteByte('-')
+			}
+			builder.WriteByte(charset[randomInt(len(charset))])
+		}
+		code := builder.String()
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+// Function to enroll a new TOTP secret, replacing any existing one
+func enrollTOTP(reader *bufio.Reader) error {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return err
+	}
+	account := "selfcontrol"
+	if host, err := os.Hostname(); err == nil {
+		account = host
+	}
+	uri := fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&algorithm=SHA1&digits=6&period=%d",
+		url.PathEscape(totpIssuer), url.PathEscape(account), secret, url.QueryEscape(totpIssuer), int(totpPeriod.Seconds()))
+	fmt.Println("\nAdd this URI to your authenticator app (or enter the secret manually):")
+	fmt.Println(uri)
+	fmt.Println("Secret:", secret)
+
+	fmt.Print("Enter the code shown by the authenticator app to confirm: ")
+	if !verifyTOTPCode(secret, readUserInput(reader)) {
+		return fmt.Errorf("code did not match, two-factor authentication was not enabled")
+	}
+
+	codes, hashes, err := generateRecoveryCodes(totpRecoveryCodeCount)
+	if err != nil {
+		return fmt.Errorf("error generating recovery codes: %v", err)
+	}
+	if err := writeTOTPConfig(totpFilePath, TOTPConfig{Secret: secret, RecoveryCodes: hashes}); err != nil {
+		return fmt.Errorf("error saving TOTP config: %v", err)
+	}
+	auditLog(actionEnrollTwoFactor, "totp", nil, nil, "")
+
+	fmt.Println("\nRecovery codes, each can be used once instead of a code. Store them somewhere safe:")
+	for _, code := range codes {
+		fmt.Println("  " + code)
+	}
+	return nil
+}
+
+// Function to ask for a TOTP or recovery code if TOTP is enrolled. Used recovery codes are removed
+func verifySecondFactor(reader *bufio.Reader) bool {
+	config, enrolled, err := readTOTPConfig(totpFilePath)
+	if err != nil {
+		fmt.Println("Error reading TOTP config:", err)
+		return false
+	}
+	if !enrolled {
+		return true
+	}
+
+	// Refuse to prompt while locked out
+	if err := authLockedOut(); err != nil {
+		fmt.Printf("Authentication code rejected: %v\n", err)
+		return false
+	}
+	fmt.Print("Enter authentication code or recovery code: ")
+	code := strings.ReplaceAll(readUserInput(reader), " ", "")
+	recoveryCode := -1
+	err = authenticateCode(func() bool {
+		if verifyTOTPCode(config.Secret, code) {
+			return true
+		}
+		for i, hash := range config.RecoveryCodes {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(strings.ToLower(code))) == nil {
+				recoveryCode = i
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		fmt.Printf("Authentication code rejected: %v\n", err)
+		return false
+	}
+
+	if recoveryCode >= 0 {
+		config.RecoveryCodes = append(config.RecoveryCodes[:recoveryCode], config.RecoveryCodes[recoveryCode+1:]...)
+		if err := writeTOTPConfig(totpFilePath, config); err != nil {
+			fmt.Println("Error saving TOTP config:", err)
+			return false
+		}
+		fmt.Printf("Recovery code used, %d remaining\n", len(config.RecoveryCodes))
+		auditLog(auditUseRecoveryCode, "totp", nil, nil, fmt.Sprintf("%d remaining", len(config.RecoveryCodes)))
+	}
+	return true
+}
+
+// Function to verify the password and second factor before privileged actions.
+// Without TOTP enrolled the logged in session is trusted, as before
+func verifyPrivileged(reader *bufio.Reader) bool {
+	_, enrolled, err := readTOTPConfig(totpFilePath)
+	if err != nil {
+		fmt.Println("Error reading TOTP config:", err)
+		return false
+	}
+	if !enrolled {
+		return true
+	}
+	return verifyPassword(reader) && verifySecondFactor(reader)
+}
@@ -4,28 +4,71 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
-)
 
-var prefixes = [3]string{"www.", "https://", "http://"}
-var suffixes = [2]string{".com", ".org"}
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
 
 func FormatString(data string) string {
 	return strings.ReplaceAll(strings.TrimSpace(strings.ToLower(data)), " ", "")
 }
 
-// Function to extract name from url
+// Function to parse a URL or domain entered by the user into a lowercase, punycode hostname
+// suitable for the hosts file. Schemes, ports, paths, queries and trailing dots are stripped
+func NormalizeDomain(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", errors.New("empty URL")
+	}
+	if !strings.Contains(input, "://") {
+		input = "http://" + input
+	}
+	parsed, err := url.Parse(input)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %v", input, err)
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" {
+		return "", fmt.Errorf("no hostname found in %q", input)
+	}
+	if net.ParseIP(host) != nil {
+		return "", fmt.Errorf("%s is an IP address, only domain names can be blocked", host)
+	}
+
+	// Convert internationalised domain names to punycode and validate label lengths and characters
+	asciiHost, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain %s: %v", host, err)
+	}
+	if !strings.Contains(asciiHost, ".") {
+		return "", fmt.Errorf("invalid domain %s: missing top level domain", asciiHost)
+	}
+	if _, err := publicsuffix.EffectiveTLDPlusOne(asciiHost); err != nil {
+		return "", fmt.Errorf("invalid domain %s: %v", asciiHost, err)
+	}
+	return asciiHost, nil
+}
+
+// Function to derive a display name from a url by removing the public suffix and a leading "www."
+// e.g. www.facebook.com -> facebook, bbc.co.uk -> bbc, news.ycombinator.com -> news.ycombinator
 func GetNameFromURL(url string) string {
-	for _, prefix := range prefixes {
-		url = strings.TrimPrefix(url, prefix)
+	host, err := NormalizeDomain(url)
+	if err != nil {
+		return FormatString(url)
 	}
-	for _, suffix := range suffixes {
-		url = strings.TrimSuffix(url, suffix)
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	name := strings.TrimSuffix(host, "."+suffix)
+	name = strings.TrimPrefix(name, "www.")
+	if unicodeName, err := idna.ToUnicode(name); err == nil {
+		name = unicodeName
 	}
-	return FormatString(url)
+	return FormatString(name)
 }
 
 // Function to format time in "HH:MM" format
@@ -100,6 +143,25 @@ func queryForTime(reader *bufio.Reader, startTime bool) string {
 	return time
 }
 
+// Function to parse a duration from the settings file, invalid or empty values count as zero
+func settingsDuration(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid duration %q in settings: %v\n", value, err)
+		return 0
+	}
+	return duration
+}
+
+// Function to ask whether a block should be locked until it expires
+func queryForLock(reader *bufio.Reader) bool {
+	fmt.Print("Lock until expiry? Locked blocks cannot be removed or shortened (y/n): ")
+	return FormatString(readUserInput(reader)) == "y"
+}
+
 // Function to get duration from user input
 func getDuration(reader *bufio.Reader) time.Duration {
 	for {
@@ -117,9 +179,212 @@ func getDuration(reader *bufio.Reader) time.Duration {
 // Function to print schedule info
 func printScheduleInfo(schedule Schedule) {
 	fmt.Printf("Name: %s\n", schedule.Name)
-	fmt.Printf("Days: %s\n", strings.Join(schedule.Days, ", "))
-	fmt.Printf("Start Time: %s\n", schedule.StartTime)
-	fmt.Printf("End Time: %s\n", schedule.EndTime)
+	if schedule.Cron != "" {
+		fmt.Printf("Cron: %s\n", schedule.Cron)
+		fmt.Printf("Duration: %s\n", schedule.Duration)
+	} else {
+		fmt.Printf("Days: %s\n", strings.Join(schedule.Days, ", "))
+		fmt.Printf("Start Time: %s\n", schedule.StartTime)
+		fmt.Printf("End Time: %s\n", schedule.EndTime)
+	}
+	if len(schedule.Valid) > 0 {
+		fmt.Printf("Valid: %s\n", strings.Join(schedule.Valid, ", "))
+	}
+	if schedule.TimeZone != "" {
+		fmt.Printf("Time zone: %s\n", schedule.TimeZone)
+	}
+	fmt.Printf("Mode: %s\n", scheduleMode(schedule))
+	if schedule.Locked {
+		fmt.Println("Locked: blocks cannot be undone until the window ends")
+	}
+	if len(schedule.Exceptions) > 0 {
+		fmt.Printf("Exceptions: %s\n", strings.Join(schedule.Exceptions, ", "))
+	}
+	now := time.Now()
+	if reason := scheduleSkipReason(schedule, getHolidays(), now); reason != "" {
+		fmt.Printf("Not running today: %s\n", reason)
+	} else if schedule.SkipDate == now.In(scheduleLocation(schedule)).Format(dateLayout) {
+		fmt.Printf("Skipped today from %s\n", displayStoredTime(schedule.SkipFrom))
+	}
+}
+
+// Function to format a time for the config and state files. Times are stored in UTC so that the offset
+// does not depend on whether daylight saving time was in effect when they were written
+func formatStoredTime(t time.Time) string {
+	return t.UTC().Format(DateTimeLayout)
+}
+
+// Function to format a time for display in the local time zone
+func formatLocalTime(t time.Time) string {
+	return t.Local().Format(DateTimeLayout)
+}
+
+// Function to show a stored time in the local time zone, values that cannot be parsed are shown as they are
+func displayStoredTime(value string) string {
+	t, err := time.Parse(DateTimeLayout, value)
+	if err != nil {
+		return value
+	}
+	return formatLocalTime(t)
+}
+
+// Function to print the next windows of the schedules and calendars, or of the one with the given name
+func printScheduleWindows(headerSchedule HeaderSchedule, name string, count int) error {
+	windows, err := previewScheduleWindows(headerSchedule, name, time.Now(), count)
+	if len(windows) == 0 && err == nil {
+		fmt.Println("No windows in the next two years")
+	}
+	for _, window := range windows {
+		fmt.Println(describeScheduleWindow(window))
+	}
+	return err
+}
+
+// Function to list the holidays that have not ended yet
+func upcomingHolidays(holidays []dateRange, currentTime time.Time) []dateRange {
+	today := currentTime.Format(dateLayout)
+	var upcoming []dateRange
+	for _, holiday := range holidays {
+		if holiday.To >= today {
+			upcoming = append(upcoming, holiday)
+		}
+	}
+	return upcoming
+}
+
+// Function to print a calendar source with its windows in the coming week
+func printCalendarInfo(calendar CalendarSource, currentTime time.Time) {
+	fmt.Printf("Name: %s\n", calendar.Name)
+	fmt.Printf("File: %s\n", calendar.File)
+	if len(calendar.Categories) > 0 {
+		fmt.Printf("Categories: %s\n", strings.Join(calendar.Categories, ", "))
+	}
+	if calendar.TitlePattern != "" {
+		fmt.Printf("Title pattern: %s\n", calendar.TitlePattern)
+	}
+	fmt.Printf("Mode: %s\n", scheduleMode(Schedule{Mode: calendar.Mode}))
+	if calendar.Locked {
+		fmt.Println("Locked: blocks cannot be undone until the event ends")
+	}
+	windows, err := calendarWindows(calendar, currentTime, currentTime.AddDate(0, 0, 7))
+	if err != nil {
+		fmt.Println("Error reading calendar:", err)
+		return
+	}
+	if len(windows) == 0 {
+		fmt.Println("No matching events in the coming week")
+		return
+	}
+	fmt.Println("Coming week:")
+	for _, window := range windows {
+		fmt.Printf("  %s\n", describeScheduleWindow(window))
+	}
+}
+
+// Function to validate a schedule mode, an empty mode defaults to blocking
+func formatScheduleMode(mode string) (string, error) {
+	mode = FormatString(mode)
+	switch mode {
+	case "", scheduleModeBlock:
+		return scheduleModeBlock, nil
+	case scheduleModeAllowlist:
+		return scheduleModeAllowlist, nil
+	}
+	return "", fmt.Errorf("invalid mode %s, expected %s or %s", mode, scheduleModeBlock, scheduleModeAllowlist)
+}
+
+// Function to get the mode of a schedule, schedules without a mode block sites
+func scheduleMode(schedule Schedule) string {
+	if schedule.Mode == "" {
+		return scheduleModeBlock
+	}
+	return schedule.Mode
+}
+
+// Function to validate and format a schedule given in full rather than field by field, e.g. through the API
+func normalizeSchedule(schedule Schedule) (Schedule, error) {
+	schedule.Name = FormatString(schedule.Name)
+	if schedule.Name == "" {
+		return Schedule{}, errors.New("schedule name is empty")
+	}
+	var err error
+	if schedule.Cron != "" {
+		if schedule.Cron, schedule.Duration, err = formatCron(schedule.Cron, schedule.Duration); err != nil {
+			return Schedule{}, err
+		}
+	} else if schedule.Duration != "" {
+		return Schedule{}, errors.New("duration is only used with a cron expression")
+	}
+	// Days and times are optional with a cron expression, which takes precedence over them
+	if schedule.Cron == "" || len(schedule.Days) > 0 || schedule.StartTime != "" || schedule.EndTime != "" {
+		days, err := formatDaysSlice(strings.Join(schedule.Days, ","))
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule.Days = days
+		if schedule.StartTime, err = FormatTime(schedule.StartTime); err != nil {
+			return Schedule{}, fmt.Errorf("start time: %v", err)
+		}
+		if schedule.EndTime, err = FormatTime(schedule.EndTime); err != nil {
+			return Schedule{}, fmt.Errorf("end time: %v", err)
+		}
+		if err := checkStartBeforeEnd(schedule.StartTime, schedule.EndTime); err != nil {
+			return Schedule{}, err
+		}
+	}
+	if schedule.Mode, err = formatScheduleMode(schedule.Mode); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.Exceptions, err = formatDateRanges(strings.Join(schedule.Exceptions, ",")); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.Valid, err = formatDateRanges(strings.Join(schedule.Valid, ",")); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.TimeZone, err = formatTimeZone(schedule.TimeZone); err != nil {
+		return Schedule{}, err
+	}
+	return schedule, nil
+}
+
+// Function to split a comma separated list of days and ranges of days, checking each of them
+func formatDateRanges(ranges string) ([]string, error) {
+	var formatted []string
+	for _, value := range strings.Split(ranges, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		dateRange, err := parseDateRange(value)
+		if err != nil {
+			return nil, err
+		}
+		formatted = append(formatted, dateRange.String())
+	}
+	return formatted, nil
+}
+
+// Function to check an IANA time zone name such as Europe/Berlin, empty stays empty for local time
+func formatTimeZone(timeZone string) (string, error) {
+	timeZone = strings.TrimSpace(timeZone)
+	if timeZone == "" {
+		return "", nil
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return "", fmt.Errorf("unknown time zone %q, expected an IANA name such as Europe/Berlin", timeZone)
+	}
+	return timeZone, nil
+}
+
+// Function to check a cron expression and the duration of its windows, returns both cleaned up
+func formatCron(expression string, duration string) (string, string, error) {
+	if _, err := parseCron(expression); err != nil {
+		return "", "", err
+	}
+	duration = strings.TrimSpace(duration)
+	if _, err := parseWindowDuration(duration); err != nil {
+		return "", "", err
+	}
+	return strings.Join(strings.Fields(expression), " "), duration, nil
 }
 
 func formatDaysSlice(days string) ([]string, error) {
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"youtube.com", "youtube.com", false},
+		{"  WWW.YouTube.com  ", "www.youtube.com", false},
+		{"https://www.youtube.com/watch?v=abc#t=10", "www.youtube.com", false},
+		{"youtube.com:8080", "youtube.com", false},
+		{"http://youtube.com:443/", "youtube.com", false},
+		{"youtube.com.", "youtube.com", false},
+		{"bbc.co.uk", "bbc.co.uk", false},
+		{"münchen.de", "xn--mnchen-3ya.de", false},
+		{"https://BÜCHER.example/", "xn--bcher-kva.example", false},
+		{"xn--mnchen-3ya.de", "xn--mnchen-3ya.de", false},
+		{"", "", true},
+		{"   ", "", true},
+		{"https://", "", true},
+		{"localhost", "", true},
+		{"192.168.1.1", "", true},
+		{"[::1]", "", true},
+		{"http://[2001:db8::1]:8080/", "", true},
+		// A public suffix on its own would block every site under it
+		{"co.uk", "", true},
+		{"github.io", "", true},
+		{"com.", "", true},
+		{"bad_label!.com", "", true},
+	}
+	for _, test := range tests {
+		got, err := NormalizeDomain(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("NormalizeDomain(%q) error = %v, want error %v", test.input, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
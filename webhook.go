@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Block lifecycle events webhooks can subscribe to
+const (
+	webhookBlockStart  = "block-start"  // Sites were blocked
+	webhookBlockExpire = "block-expire" // A block ran until its expiry time
+	webhookBlockCancel = "block-cancel" // A block was removed before it expired, by hand or after the unblock cooldown
+	webhookTamper      = "tamper"       // A hosts entry was removed outside selfcontrol and put back
+)
+
+// WebhookSettings is an endpoint block lifecycle events are posted to as JSON
+type WebhookSettings struct {
+	URL    string   `yaml:"url"`
+	Events []string `yaml:"events,omitempty"` // Events to post, any of block-start, block-expire, block-cancel and tamper. Defaults to all of them
+	Secret string   `yaml:"secret,omitempty"` // Signs the body with HMAC-SHA256 in the X-Selfcontrol-Signature header
+}
+
+// WebhookEvent is the JSON body posted to webhooks
+type WebhookEvent struct {
+	ID     string `json:"id"` // Unique per event, receivers can use it to drop repeated deliveries
+	Event  string `json:"event"`
+	Time   string `json:"time"`
+	Host   string `json:"host"`
+	Target string `json:"target"`           // Site url, or all
+	Expiry string `json:"expiry,omitempty"` // Expiry time of a started block
+	Detail string `json:"detail,omitempty"` // What started the block, or the cause of an unblock
+}
+
+// spooledWebhook is an event waiting in the spool directory until its endpoint accepts it
+type spooledWebhook struct {
+	URL   string       `json:"url"`
+	Event WebhookEvent `json:"event"`
+}
+
+// Function to get the spool directory, falling back to the absolute path when started by systemd outside the application directory
+func getWebhookSpoolDir() string {
+	if _, err := os.Stat(filepath.Dir(webhookSpoolDir)); err != nil {
+		return absolutePathToSelfControl + "/" + webhookSpoolDir
+	}
+	return webhookSpoolDir
+}
+
+// Function to post an event to every webhook subscribed to it. Events are spooled to disk first
+// and delivered in the background, so an endpoint that is down never holds up blocking
+func notifyWebhooks(event string, target string, expiry string, detail string) {
+	webhooks := getSettings().Webhooks
+	if len(webhooks) == 0 {
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	host, _ := os.Hostname()
+	payload := WebhookEvent{
+		ID:     hex.EncodeToString(id),
+		Event:  event,
+		Time:   formatStoredTime(time.Now()),
+		Host:   host,
+		Target: target,
+		Expiry: expiry,
+		Detail: detail,
+	}
+
+	for i, webhook := range webhooks {
+		if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, event) {
+			continue
+		}
+		path, err := spoolWebhook(spooledWebhook{URL: webhook.URL, Event: payload}, i)
+		if err != nil {
+			logger.Error("Error spooling webhook event", "url", webhook.URL, "event", event, "error", err)
+			continue
+		}
+		go deliverSpooledWebhook(path, webhookAttempts)
+	}
+}
+
+// Function to write an event to the spool directory, returns the path of the spool file
+func spoolWebhook(spooled spooledWebhook, index int) (string, error) {
+	dir := getWebhookSpoolDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(spooled)
+	if err != nil {
+		return "", err
+	}
+	// Names sort by creation time so the spool is flushed in order
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s-%d.json", time.Now().UnixNano(), spooled.Event.ID, index))
+	return path, os.WriteFile(path, data, 0600)
+}
+
+// Function to post a spooled event, retrying with a growing delay. The spool file is removed once
+// the endpoint accepts the event, otherwise it stays for flushWebhookSpool to try again later
+func deliverSpooledWebhook(path string, attempts int) {
+	file, err := os.Open(path)
+	if err != nil {
+		return // Delivered in the meantime
+	}
+	defer file.Close()
+
+	// The process handing over to the background process may flush the same spool, only one of them sends
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	var spooled spooledWebhook
+	if err := json.NewDecoder(file).Decode(&spooled); err != nil {
+		logger.Error("Dropping unreadable webhook spool file", "file", path, "error", err)
+		os.Remove(path)
+		return
+	}
+	webhook, configured := findWebhook(spooled.URL)
+	if !configured {
+		logger.Info("Dropping spooled webhook event, the webhook is no longer configured", "url", spooled.URL, "event", spooled.Event.Event)
+		os.Remove(path)
+		return
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(webhook, spooled.Event)
+		if err == nil {
+			logger.Debug("Delivered webhook event", "url", webhook.URL, "event", spooled.Event.Event, "id", spooled.Event.ID)
+			os.Remove(path)
+			return
+		}
+		if attempt >= attempts {
+			logger.Warn("Webhook delivery failed, keeping the event in the spool", "url", webhook.URL, "event", spooled.Event.Event, "attempts", attempt, "error", err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Function to look up the settings of a webhook by its url
+func findWebhook(url string) (WebhookSettings, bool) {
+	for _, webhook := range getSettings().Webhooks {
+		if webhook.URL == url {
+			return webhook, true
+		}
+	}
+	return WebhookSettings{}, false
+}
+
+// Function to post an event to a webhook, any 2xx response counts as delivered
+func postWebhook(webhook WebhookSettings, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Selfcontrol-Event", event.Event)
+	if webhook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(webhook.Secret))
+		mac.Write(body)
+		request.Header.Set("X-Selfcontrol-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", response.Status)
+	}
+	return nil
+}
+
+// Function to deliver spooled events in order of creation, one attempt each
+func flushWebhookSpool() {
+	entries, err := os.ReadDir(getWebhookSpoolDir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error("Error reading webhook spool", "error", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			deliverSpooledWebhook(filepath.Join(getWebhookSpoolDir(), entry.Name()), 1)
+		}
+	}
+}
+
+// Function to retry spooled events periodically for as long as the process runs
+func startWebhookSpooler() {
+	if len(getSettings().Webhooks) == 0 {
+		return
+	}
+	go func() {
+		flushWebhookSpool()
+		ticker := time.NewTicker(webhookSpoolInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushWebhookSpool()
+		}
+	}()
+}